@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+	"strconv"
+)
+
+type ReconcileStorageHandler func(dryRun bool) (reconcileResponse dto.ReconcileResponse, err error)
+type GetStatsHandler func() (statsResponse dto.StatsResponse)
+type ReapExpiredLeasesHandler func() (reapResponse dto.ReapResponse, err error)
+
+type EnqueueDueJobsHandler func() (scheduleResponse dto.ScheduleResponse, err error)
+
+func HandleReconcileStorage(handler ReconcileStorageHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		// Default to a dry run so a bare call never deletes anything
+		dryRun, err := strconv.ParseBool(g.DefaultQuery("dry_run", "true"))
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid dry_run value"))
+			return
+		}
+
+		resp, err := handler(dryRun)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success reconcile storage")
+	}
+}
+
+func HandleGetStats(handler GetStatsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		resp := handler()
+		ginhttputil.WriteSuccessResponse(g, resp, "success get stats")
+	}
+}
+
+func HandleEnqueueDueJobs(handler EnqueueDueJobsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		resp, err := handler()
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success enqueue due jobs")
+	}
+}
+
+func HandleReapExpiredLeases(handler ReapExpiredLeasesHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		resp, err := handler()
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success reap expired leases")
+	}
+}
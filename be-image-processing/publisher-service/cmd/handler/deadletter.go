@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+	"strconv"
+)
+
+type ListDeadLettersHandler func(limit int) (deadLetterListResponse dto.DeadLetterListResponse, err error)
+type GetDeadLetterHandler func(messageID string) (deadLetterMessage dto.DeadLetterMessage, err error)
+type DeadLetterActionHandler func(selection dto.DeadLetterSelection) (deadLetterActionResponse dto.DeadLetterActionResponse, err error)
+
+func HandleListDeadLetters(handler ListDeadLettersHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		limit, err := strconv.Atoi(g.DefaultQuery("limit", "50"))
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid limit value"))
+			return
+		}
+
+		resp, err := handler(limit)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success list dead letters")
+	}
+}
+
+func HandleGetDeadLetter(handler GetDeadLetterHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		resp, err := handler(g.Param("messageId"))
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success get dead letter")
+	}
+}
+
+func HandleReplayDeadLetters(handler DeadLetterActionHandler) gin.HandlerFunc {
+	return handleDeadLetterAction(handler, "success replay dead letters")
+}
+
+func HandlePurgeDeadLetters(handler DeadLetterActionHandler) gin.HandlerFunc {
+	return handleDeadLetterAction(handler, "success purge dead letters")
+}
+
+func handleDeadLetterAction(handler DeadLetterActionHandler, message string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		var selection dto.DeadLetterSelection
+		if err := g.ShouldBindJSON(&selection); err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid request body"))
+			return
+		}
+
+		resp, err := handler(selection)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, message)
+	}
+}
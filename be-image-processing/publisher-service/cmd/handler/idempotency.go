@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+)
+
+type ClaimIdempotencyKeyHandler func(key, requestHash string) (claimToken string, replay *dto.IdempotentResponse, err error)
+type CompleteIdempotencyKeyHandler func(key, claimToken string, response dto.IdempotentResponse) (err error)
+type ReleaseIdempotencyKeyHandler func(key, claimToken string) (err error)
+
+// HandleIdempotencyKey lets clients retry the routes it guards without
+// repeating their effect. The first response for an Idempotency-Key is stored
+// and replayed for repeats of the same request; a different request under the
+// same key is a conflict. Server errors and panics are not stored, so the
+// client can retry them. The response is stored, or the key released, under
+// the token of this request's claim, so a request whose claim expired and was
+// taken over leaves the new claim alone. Requests without the header are
+// passed through.
+func HandleIdempotencyKey(claim ClaimIdempotencyKeyHandler, complete CompleteIdempotencyKeyHandler, release ReleaseIdempotencyKeyHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		key := g.GetHeader(ginhttputil.HeaderIdempotencyKey)
+		if key == "" {
+			g.Next()
+			return
+		}
+
+		requestHash, err := ginhttputil.HashRequest(g)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid request body"))
+			g.Abort()
+			return
+		}
+
+		claimToken, replay, err := claim(key, requestHash)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			g.Abort()
+			return
+		}
+
+		if replay != nil {
+			g.Header(ginhttputil.HeaderIdempotentReplayed, "true")
+			g.Data(replay.Status, replay.ContentType, replay.Body)
+			g.Abort()
+			return
+		}
+
+		// A panicking handler would otherwise leave the key claimed until the
+		// lock timeout, answering every retry with a conflict
+		defer func() {
+			if r := recover(); r != nil {
+				release(key, claimToken)
+				panic(r)
+			}
+		}()
+
+		recorder := ginhttputil.NewResponseRecorder(g.Writer)
+		g.Writer = recorder
+
+		g.Next()
+
+		// Failures to store or release the key are logged by the service;
+		// the response has already been sent either way
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			release(key, claimToken)
+			return
+		}
+
+		complete(key, claimToken, dto.IdempotentResponse{
+			Status:      status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.Body(),
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/repository"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+)
+
+// fakeKeys holds claims like the idempotency_keys table: a key has at most
+// one claim, and only the token of that claim stores a response or releases
+// the key
+type fakeKeys struct {
+	replay   *dto.IdempotentResponse
+	claimErr error
+
+	tokens    int
+	claims    map[string]string
+	stored    map[string]dto.IdempotentResponse
+	claimed   int
+	completed int
+	released  int
+}
+
+func (f *fakeKeys) claim(key, requestHash string) (string, *dto.IdempotentResponse, error) {
+	if f.claimErr != nil || f.replay != nil {
+		return "", f.replay, f.claimErr
+	}
+	if f.claims == nil {
+		f.claims = map[string]string{}
+		f.stored = map[string]dto.IdempotentResponse{}
+	}
+
+	f.tokens++
+	token := fmt.Sprintf("claim-%d", f.tokens)
+	f.claims[key] = token
+	f.claimed++
+	return token, nil, nil
+}
+
+func (f *fakeKeys) complete(key, claimToken string, response dto.IdempotentResponse) error {
+	if f.claims[key] != claimToken {
+		return repository.ErrIdempotencyClaimLost
+	}
+	delete(f.claims, key)
+	f.stored[key] = response
+	f.completed++
+	return nil
+}
+
+func (f *fakeKeys) release(key, claimToken string) error {
+	if f.claims[key] != claimToken {
+		return repository.ErrIdempotencyClaimLost
+	}
+	delete(f.claims, key)
+	f.released++
+	return nil
+}
+
+func serveIdempotent(keys *fakeKeys, key string, handle gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	gn := gin.New()
+	gn.POST("/jobs/:id/retry", HandleIdempotencyKey(keys.claim, keys.complete, keys.release), handle)
+
+	request := httptest.NewRequest(http.MethodPost, "/jobs/1/retry", strings.NewReader(`{}`))
+	if key != "" {
+		request.Header.Set(ginhttputil.HeaderIdempotencyKey, key)
+	}
+	response := httptest.NewRecorder()
+	gn.ServeHTTP(response, request)
+	return response
+}
+
+func TestHandleIdempotencyKey(t *testing.T) {
+	accepted := func(g *gin.Context) { g.JSON(http.StatusAccepted, gin.H{"id": 1}) }
+
+	tests := []struct {
+		name         string
+		key          string
+		keys         fakeKeys
+		handle       gin.HandlerFunc
+		wantStatus   int
+		wantBody     string
+		wantReplay   bool
+		wantClaimed  int
+		wantComplete int
+		wantRelease  int
+	}{
+		{
+			name:       "no key passes through",
+			handle:     accepted,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:         "claimed key stores the response",
+			key:          "k1",
+			handle:       accepted,
+			wantStatus:   http.StatusAccepted,
+			wantBody:     `{"id":1}`,
+			wantClaimed:  1,
+			wantComplete: 1,
+		},
+		{
+			name:       "stored response is replayed",
+			key:        "k1",
+			keys:       fakeKeys{replay: &dto.IdempotentResponse{Status: http.StatusAccepted, ContentType: "application/json", Body: []byte(`{"id":1}`)}},
+			handle:     func(g *gin.Context) { t.Error("handler ran for a replayed request") },
+			wantStatus: http.StatusAccepted,
+			wantBody:   `{"id":1}`,
+			wantReplay: true,
+		},
+		{
+			name:       "key in use is a conflict",
+			key:        "k1",
+			keys:       fakeKeys{claimErr: apperror.Conflict("a request with Idempotency-Key %q is still in progress", "k1")},
+			handle:     func(g *gin.Context) { t.Error("handler ran without a claim") },
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:        "server error releases the key",
+			key:         "k1",
+			handle:      func(g *gin.Context) { g.Status(http.StatusInternalServerError) },
+			wantStatus:  http.StatusInternalServerError,
+			wantClaimed: 1,
+			wantRelease: 1,
+		},
+		{
+			name:         "client error is stored",
+			key:          "k1",
+			handle:       func(g *gin.Context) { g.Status(http.StatusNotFound) },
+			wantStatus:   http.StatusNotFound,
+			wantClaimed:  1,
+			wantComplete: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serveIdempotent(&tt.keys, tt.key, tt.handle)
+
+			if response.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && response.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", response.Body.String(), tt.wantBody)
+			}
+			if replayed := response.Header().Get(ginhttputil.HeaderIdempotentReplayed) == "true"; replayed != tt.wantReplay {
+				t.Errorf("replayed = %t, want %t", replayed, tt.wantReplay)
+			}
+			if tt.keys.claimed != tt.wantClaimed || tt.keys.completed != tt.wantComplete || tt.keys.released != tt.wantRelease {
+				t.Errorf("claimed %d, completed %d, released %d; want %d, %d, %d",
+					tt.keys.claimed, tt.keys.completed, tt.keys.released, tt.wantClaimed, tt.wantComplete, tt.wantRelease)
+			}
+			if tt.wantComplete > 0 && tt.keys.stored[tt.key].Status != tt.wantStatus {
+				t.Errorf("stored status = %d, want %d", tt.keys.stored[tt.key].Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// A request that outlives its claim finishes after an identical retry took
+// the key over. Whether it succeeds or fails, the retry's claim must survive
+// and be the one that stores its response.
+func TestHandleIdempotencyKeyStaleClaim(t *testing.T) {
+	for _, staleStatus := range []int{http.StatusAccepted, http.StatusInternalServerError} {
+		t.Run(http.StatusText(staleStatus), func(t *testing.T) {
+			keys := &fakeKeys{}
+
+			var retryToken string
+			serveIdempotent(keys, "k1", func(g *gin.Context) {
+				// The claim expires while the handler runs and the retry of
+				// the same request claims the key again
+				retryToken, _, _ = keys.claim("k1", "same-hash")
+				g.Status(staleStatus)
+			})
+
+			if keys.completed != 0 || keys.released != 0 {
+				t.Fatalf("stale request completed %d and released %d, want neither", keys.completed, keys.released)
+			}
+			if keys.claims["k1"] != retryToken {
+				t.Fatalf("claim = %q, want the retry's %q", keys.claims["k1"], retryToken)
+			}
+
+			retry := dto.IdempotentResponse{Status: http.StatusAccepted}
+			if err := keys.complete("k1", retryToken, retry); err != nil {
+				t.Fatalf("retry completing its claim: %v", err)
+			}
+			if keys.stored["k1"].Status != http.StatusAccepted {
+				t.Errorf("stored status = %d, want the retry's %d", keys.stored["k1"].Status, http.StatusAccepted)
+			}
+		})
+	}
+}
+
+func TestHandleIdempotencyKeyReleasesOnPanic(t *testing.T) {
+	keys := &fakeKeys{}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("panic was swallowed, want it re-raised")
+		}
+		if keys.released != 1 || keys.completed != 0 {
+			t.Errorf("completed %d, released %d; want the key released", keys.completed, keys.released)
+		}
+	}()
+
+	serveIdempotent(keys, "k1", func(g *gin.Context) { panic("boom") })
+}
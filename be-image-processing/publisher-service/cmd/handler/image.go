@@ -8,11 +8,13 @@ import (
 	"publisher-service/internal/util/ginhttputil"
 	"publisher-service/internal/util/helper"
 	"publisher-service/pkg/dto"
+	"shared/messaging"
+	"time"
 )
 
-type ImageUploadHandler func(g *gin.Context, files []*multipart.FileHeader) (imageResponse dto.ImageResponse, err error)
-type ServeImageUploadedHandler func(filename string) (imagePath string, isExist bool, err error)
-type ServeImageCompressedHandler func(filename string) (imagePath string, isExist bool, err error)
+type ImageUploadHandler func(g *gin.Context, files []*multipart.FileHeader, priority messaging.Priority, processAfter *time.Time) (imageResponse dto.ImageResponse, err error)
+type ServeImageUploadedHandler func(filename string) (imagePath string, isExist bool, isExpired bool, err error)
+type ServeImageCompressedHandler func(filename string, accept string) (imagePath string, isExist bool, isExpired bool, err error)
 type CompressedUploadHandler func(g *gin.Context, files *multipart.FileHeader) (compressedImageResponse dto.CompressedImageResponse, err error)
 
 func HandleImageUpload(handler ImageUploadHandler) gin.HandlerFunc {
@@ -30,7 +32,24 @@ func HandleImageUpload(handler ImageUploadHandler) gin.HandlerFunc {
 			return
 		}
 
-		resp, err := handler(g, files)
+		priority, err := messaging.ParsePriority(g.PostForm("priority"))
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, err)
+			return
+		}
+
+		// Jobs with a process_after in the future wait until then to be queued
+		var processAfter *time.Time
+		if value := g.PostForm("process_after"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("process_after must be an RFC 3339 timestamp"))
+				return
+			}
+			processAfter = &parsed
+		}
+
+		resp, err := handler(g, files, priority, processAfter)
 		if err != nil {
 			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
 			return
@@ -45,7 +64,7 @@ func HandleImageUpload(handler ImageUploadHandler) gin.HandlerFunc {
 	}
 }
 
-func HandleServeImageUploaded(handler ServeImageUploadedHandler) gin.HandlerFunc {
+func HandleServeImageUploaded(handler ServeImageUploadedHandler, cacheControl string) gin.HandlerFunc {
 	return func(g *gin.Context) {
 		filename := g.Param("filename")
 
@@ -55,10 +74,10 @@ func HandleServeImageUploaded(handler ServeImageUploadedHandler) gin.HandlerFunc
 			return
 		}
 
-		resp, isExist, err := handler(filename)
+		resp, isExist, isExpired, err := handler(filename)
 
-		if err != nil {
-			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+		if isExpired {
+			ginhttputil.WriteErrorResponse(g, http.StatusGone, errors.New("image expired"))
 			return
 		}
 
@@ -67,12 +86,21 @@ func HandleServeImageUploaded(handler ServeImageUploadedHandler) gin.HandlerFunc
 			return
 		}
 
-		g.File(resp)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			return
+		}
+
+		ginhttputil.WriteFileResponse(g, resp, cacheControl)
 	}
 }
 
-func HandleServeImageCompressed(handler ServeImageCompressedHandler) gin.HandlerFunc {
+func HandleServeImageCompressed(handler ServeImageCompressedHandler, cacheControl string) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		// The served format depends on Accept, so shared caches must key on
+		// it, including for errors
+		g.Header(ginhttputil.HeaderVary, ginhttputil.HeaderAccept)
+
 		filename := g.Param("filename")
 
 		// Validate filename to avoid path traversal
@@ -81,10 +109,10 @@ func HandleServeImageCompressed(handler ServeImageCompressedHandler) gin.Handler
 			return
 		}
 
-		resp, isExist, err := handler(filename)
+		resp, isExist, isExpired, err := handler(filename, g.GetHeader(ginhttputil.HeaderAccept))
 
-		if err != nil {
-			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+		if isExpired {
+			ginhttputil.WriteErrorResponse(g, http.StatusGone, errors.New("image expired"))
 			return
 		}
 
@@ -93,7 +121,12 @@ func HandleServeImageCompressed(handler ServeImageCompressedHandler) gin.Handler
 			return
 		}
 
-		g.File(resp)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			return
+		}
+
+		ginhttputil.WriteFileResponse(g, resp, cacheControl)
 	}
 }
 
@@ -106,7 +139,7 @@ func HandleCompressedUpload(handler CompressedUploadHandler) gin.HandlerFunc {
 			return
 		}
 
-		if !helper.IsImage(file.Filename) {
+		if !helper.IsOutputImage(file.Filename) {
 			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("uploaded file is not a valid image"))
 			return
 		}
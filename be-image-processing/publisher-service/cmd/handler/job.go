@@ -3,28 +3,47 @@ package handler
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
+	"publisher-service/internal/apperror"
 	"publisher-service/internal/util/ginhttputil"
 	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"shared/messaging"
 	"strconv"
 )
 
-type GetJobsHandler func() (imageJobsResponse []dto.ImageJob, err error)
+type GetJobsHandler func(priority string) (imageJobsResponse []dto.ImageJob, err error)
 type GetJobHandler func(id int64) (imageJobResponse dto.ImageJob, err error)
-type GetJobByStatusHandler func(status string) (imageJobResponse []dto.ImageJob, err error)
+type GetJobByStatusHandler func(status, priority string) (imageJobResponse []dto.ImageJob, err error)
 type GetJobRetryHandler func(id int64) (err error)
+type RetryJobsHandler func(bulkRetryRequest dto.BulkRetryRequest) (bulkJobResponse dto.BulkJobResponse, err error)
+type ReprocessJobHandler func(id int64, reprocessRequest dto.ReprocessRequest) (reprocessJobResponse dto.ReprocessJobResponse, err error)
+type ReprocessJobsHandler func(bulkReprocessRequest dto.BulkReprocessRequest) (bulkJobResponse dto.BulkJobResponse, err error)
+type CancelJobHandler func(id int64) (cancelJobResponse dto.CancelJobResponse, err error)
+type DeleteJobHandler func(id int64) (err error)
+type DeleteJobsHandler func(filter dto.JobFilter) (bulkJobResponse dto.BulkJobResponse, err error)
+type GetJobAttemptsHandler func(id int64) (jobAttemptsResponse []dto.JobAttempt, err error)
+type GetJobEventsHandler func(id int64) (jobEventsResponse []dto.JobEvent, err error)
 
 func HandleGetJobs(handler GetJobsHandler) gin.HandlerFunc {
 	return func(g *gin.Context) {
-		resp, err := handler()
+		priority := g.Query("priority")
+		if priority != "" {
+			if _, err := messaging.ParsePriority(priority); err != nil {
+				ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		resp, err := handler(priority)
 
 		if err != nil {
 			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
-
+			return
 		}
 
 		ginhttputil.WriteSuccessResponse(g, resp, "success get jobs")
-
 	}
 }
 
@@ -59,12 +78,20 @@ func HandleGetJobByStatus(handler GetJobByStatusHandler) gin.HandlerFunc {
 	return func(g *gin.Context) {
 		status := g.Param("status")
 
-		if status != "pending" && status != "processing" && status != "completed" && status != "failed" {
-			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid status. Must be one of: pending, processing, complete, failed"))
+		if !jobstate.IsValid(jobstate.Status(status)) {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid status. Must be one of: pending, processing, retrying, completed, failed, cancelled, scheduled"))
 			return
 		}
 
-		resp, err := handler(status)
+		priority := g.Query("priority")
+		if priority != "" {
+			if _, err := messaging.ParsePriority(priority); err != nil {
+				ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		resp, err := handler(status, priority)
 
 		if len(resp) == 0 {
 			ginhttputil.WriteErrorResponse(g, http.StatusNotFound, errors.New("job not found"))
@@ -94,7 +121,7 @@ func HandleRetryJobs(handler GetJobRetryHandler) gin.HandlerFunc {
 		err = handler(id)
 
 		if err != nil {
-			ginhttputil.WriteErrorResponse(g, http.StatusInternalServerError, err)
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
 			return
 		}
 
@@ -102,3 +129,153 @@ func HandleRetryJobs(handler GetJobRetryHandler) gin.HandlerFunc {
 
 	}
 }
+
+func HandleCancelJob(handler CancelJobHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		resp, err := handler(id)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success cancel job")
+	}
+}
+
+func HandleDeleteJob(handler DeleteJobHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		if err := handler(id); err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, nil, "success delete job")
+	}
+}
+
+func HandleDeleteJobs(handler DeleteJobsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		var filter dto.JobFilter
+		if err := g.ShouldBindQuery(&filter); err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job filter"))
+			return
+		}
+
+		resp, err := handler(filter)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success delete jobs")
+	}
+}
+
+func HandleRetryJobsByFilter(handler RetryJobsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		var bulkRetryRequest dto.BulkRetryRequest
+		if err := g.ShouldBindJSON(&bulkRetryRequest); err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job filter"))
+			return
+		}
+
+		resp, err := handler(bulkRetryRequest)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success retry jobs")
+	}
+}
+
+func HandleReprocessJob(handler ReprocessJobHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		// Without a body the new revision uses the worker's default options
+		var reprocessRequest dto.ReprocessRequest
+		if err := g.ShouldBindJSON(&reprocessRequest); err != nil && !errors.Is(err, io.EOF) {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid processing options"))
+			return
+		}
+
+		resp, err := handler(id, reprocessRequest)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "Job queued for reprocessing")
+	}
+}
+
+func HandleReprocessJobs(handler ReprocessJobsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		var bulkReprocessRequest dto.BulkReprocessRequest
+		if err := g.ShouldBindJSON(&bulkReprocessRequest); err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job filter"))
+			return
+		}
+
+		resp, err := handler(bulkReprocessRequest)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success reprocess jobs")
+	}
+}
+
+func HandleGetJobAttempts(handler GetJobAttemptsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		resp, err := handler(id)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success get job attempts")
+	}
+}
+
+func HandleGetJobEvents(handler GetJobEventsHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id, err := strconv.ParseInt(g.Param("id"), 10, 64)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		resp, err := handler(id)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		ginhttputil.WriteSuccessResponse(g, resp, "success get job events")
+	}
+}
@@ -2,11 +2,13 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"publisher-service/internal/util/ginhttputil"
 	"publisher-service/pkg/dto"
 )
 
 type PingHandler func() (pingResponse dto.PublicPingResponse)
+type HealthHandler func() (healthResponse dto.HealthResponse, healthy bool)
 
 func HandlePing(handler PingHandler) gin.HandlerFunc {
 	return func(g *gin.Context) {
@@ -14,3 +16,18 @@ func HandlePing(handler PingHandler) gin.HandlerFunc {
 		ginhttputil.WriteSuccessResponse(g, resp, "")
 	}
 }
+
+func HandleHealth(handler HealthHandler) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		resp, healthy := handler()
+		if !healthy {
+			g.JSON(http.StatusServiceUnavailable, dto.BaseResponse{
+				Success: false,
+				Message: "service unhealthy",
+				Data:    resp,
+			})
+			return
+		}
+		ginhttputil.WriteSuccessResponse(g, resp, "")
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+	"strconv"
+)
+
+type RenderImageHandler func(jobID int64, renderOptions dto.RenderOptions) (rendered *os.File, err error)
+
+func HandleRenderImage(handler RenderImageHandler, cacheControl string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		idStr := g.Param("jobId")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid job ID"))
+			return
+		}
+
+		var renderOptions dto.RenderOptions
+		if err := g.ShouldBindQuery(&renderOptions); err != nil {
+			ginhttputil.WriteErrorResponse(g, http.StatusBadRequest, errors.New("invalid render options"))
+			return
+		}
+
+		rendered, err := handler(id, renderOptions)
+		if err != nil {
+			ginhttputil.WriteErrorResponse(g, apperror.Status(err, http.StatusInternalServerError), err)
+			return
+		}
+		defer rendered.Close()
+
+		ginhttputil.WriteOpenFileResponse(g, rendered, cacheControl)
+	}
+}
@@ -0,0 +1,30 @@
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"publisher-service/internal/util/ginhttputil"
+)
+
+const HeaderAdminToken = "X-Admin-Token"
+
+// requireAdminToken rejects requests without the configured admin token. When
+// no token is configured the admin routes are left open.
+func requireAdminToken(token string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if token == "" {
+			g.Next()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(g.GetHeader(HeaderAdminToken)), []byte(token)) != 1 {
+			ginhttputil.WriteErrorResponse(g, http.StatusUnauthorized, errors.New("invalid admin token"))
+			g.Abort()
+			return
+		}
+
+		g.Next()
+	}
+}
@@ -6,12 +6,19 @@ import (
 	"publisher-service/cmd/handler"
 	"publisher-service/internal/config"
 	"publisher-service/internal/service"
+	"publisher-service/internal/util/ginhttputil"
 )
 
 const (
-	HeaderOrigin      = "Origin"
-	HeaderContentType = "Content-Type"
-	HeaderAccept      = "Accept"
+	HeaderOrigin        = "Origin"
+	HeaderContentType   = "Content-Type"
+	HeaderAccept        = "Accept"
+	HeaderRange         = "Range"
+	HeaderIfNoneMatch   = "If-None-Match"
+	HeaderETag          = "ETag"
+	HeaderContentRange  = "Content-Range"
+	HeaderAcceptRanges  = "Accept-Ranges"
+	HeaderContentLength = "Content-Length"
 )
 
 type InitRouterParams struct {
@@ -22,17 +29,45 @@ type InitRouterParams struct {
 
 func Init(params *InitRouterParams) {
 	params.Gn.Use(cors.New(cors.Config{
-		AllowOrigins: params.Conf.CorsAllowOrigins,
-		AllowHeaders: []string{HeaderOrigin, HeaderContentType, HeaderAccept},
+		AllowOrigins:  params.Conf.CorsAllowOrigins,
+		AllowHeaders:  []string{HeaderOrigin, HeaderContentType, HeaderAccept, HeaderRange, HeaderIfNoneMatch, ginhttputil.HeaderIdempotencyKey},
+		ExposeHeaders: []string{HeaderETag, HeaderContentRange, HeaderAcceptRanges, HeaderContentLength, ginhttputil.HeaderIdempotentReplayed},
 	}))
 
+	idempotent := handler.HandleIdempotencyKey(params.Service.ClaimIdempotencyKey, params.Service.CompleteIdempotencyKey, params.Service.ReleaseIdempotencyKey)
+
 	params.Gn.GET("/ping", handler.HandlePing(params.Service.Ping))
-	params.Gn.POST("/upload", handler.HandleImageUpload(params.Service.HandleUpload))
+	params.Gn.GET("/health", handler.HandleHealth(params.Service.Health))
+	params.Gn.POST("/upload", idempotent, handler.HandleImageUpload(params.Service.HandleUpload))
 	params.Gn.GET("/jobs", handler.HandleGetJobs(params.Service.GetJobs))
 	params.Gn.GET("jobs/:id", handler.HandleGetJob(params.Service.GetJob))
 	params.Gn.GET("/jobs/status/:status", handler.HandleGetJobByStatus(params.Service.GetJobsByStatus))
-	params.Gn.POST("/jobs/:id/retry", handler.HandleRetryJobs(params.Service.RetryJob))
-	params.Gn.GET("/images-uploaded/:filename", handler.HandleServeImageUploaded(params.Service.ServeImageUploaded))
-	params.Gn.GET("/images-compressed/:filename", handler.HandleServeImageCompressed(params.Service.ServeImageCompressed))
+	params.Gn.POST("/jobs/:id/retry", idempotent, handler.HandleRetryJobs(params.Service.RetryJob))
+	params.Gn.POST("/jobs/retry", handler.HandleRetryJobsByFilter(params.Service.RetryJobs))
+	params.Gn.POST("/jobs/:id/reprocess", handler.HandleReprocessJob(params.Service.ReprocessJob))
+	params.Gn.POST("/jobs/reprocess", handler.HandleReprocessJobs(params.Service.ReprocessJobs))
+	params.Gn.POST("/jobs/:id/cancel", handler.HandleCancelJob(params.Service.CancelJob))
+	params.Gn.DELETE("/jobs/:id", handler.HandleDeleteJob(params.Service.DeleteJob))
+	params.Gn.DELETE("/jobs", handler.HandleDeleteJobs(params.Service.DeleteJobs))
+	params.Gn.GET("/jobs/:id/attempts", handler.HandleGetJobAttempts(params.Service.GetJobAttempts))
+	params.Gn.GET("/jobs/:id/events", handler.HandleGetJobEvents(params.Service.GetJobEvents))
+
+	serveUploaded := handler.HandleServeImageUploaded(params.Service.ServeImageUploaded, params.Conf.CacheConfig.UploadedCacheControl)
+	serveCompressed := handler.HandleServeImageCompressed(params.Service.ServeImageCompressed, params.Conf.CacheConfig.CompressedCacheControl)
+	params.Gn.GET("/images-uploaded/:filename", serveUploaded)
+	params.Gn.HEAD("/images-uploaded/:filename", serveUploaded)
+	params.Gn.GET("/images-compressed/:filename", serveCompressed)
+	params.Gn.HEAD("/images-compressed/:filename", serveCompressed)
 	params.Gn.POST("/compressed", handler.HandleCompressedUpload(params.Service.CompressedUpload))
+	params.Gn.GET("/render/:jobId", handler.HandleRenderImage(params.Service.RenderImage, params.Conf.RenderConfig.CacheControl))
+
+	admin := params.Gn.Group("/admin", requireAdminToken(params.Conf.AdminToken))
+	admin.POST("/reconcile", handler.HandleReconcileStorage(params.Service.ReconcileStorage))
+	admin.GET("/stats", handler.HandleGetStats(params.Service.GetStats))
+	admin.POST("/reap", handler.HandleReapExpiredLeases(params.Service.ReapExpiredLeases))
+	admin.POST("/schedule", handler.HandleEnqueueDueJobs(params.Service.EnqueueDueJobs))
+	admin.GET("/dlq", handler.HandleListDeadLetters(params.Service.ListDeadLetters))
+	admin.GET("/dlq/:messageId", handler.HandleGetDeadLetter(params.Service.GetDeadLetter))
+	admin.POST("/dlq/replay", handler.HandleReplayDeadLetters(params.Service.ReplayDeadLetters))
+	admin.POST("/dlq/purge", handler.HandlePurgeDeadLetters(params.Service.PurgeDeadLetters))
 }
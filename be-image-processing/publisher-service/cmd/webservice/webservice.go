@@ -1,15 +1,24 @@
 package webservice
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"publisher-service/cmd/router"
+	"publisher-service/cmd/worker"
 	"publisher-service/internal/config"
 	"publisher-service/internal/repository"
 	"publisher-service/internal/service"
+	"publisher-service/internal/util/diskcache"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const logTagStartWebservice = "[Start]"
@@ -34,16 +43,26 @@ func Start(conf *config.Config) {
 	if err != nil {
 		slog.Error(fmt.Sprintf("%s initializing  db: %+v", logTagStartWebservice, err))
 	}
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
 
 	rabbitmq, err := config.InitRabbitMQ(&config.InitRabbitMQParams{
 		Conf: &conf.RabbitMQConfig,
 	})
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Failed to initialize RabbitMQ: %v", err))
+		slog.Error(fmt.Sprintf("Failed to initialize RabbitMQ, retrying in background: %v", err))
 	}
 	defer rabbitmq.Close()
 
+	renderCache, err := diskcache.New(conf.RenderConfig.CacheDir, conf.RenderConfig.CacheMaxBytes)
+	if err != nil {
+		log.Fatalf("Failed to initialize render cache: %v", err)
+	}
+
 	gin.SetMode(conf.GinMode)
 	gn := gin.New()
 	repo := repository.NewRepository(&repository.NewRepositoryParams{
@@ -51,10 +70,60 @@ func Start(conf *config.Config) {
 	})
 
 	serv := service.NewService(&service.NewServiceParams{
-		Repository: repo,
-		RabbitMQ:   rabbitmq,
+		Repository:  repo,
+		RabbitMQ:    rabbitmq,
+		RenderCache: renderCache,
+		Conf:        conf,
+	})
+
+	// SIGTERM cancels ctx; the background workers and the HTTP server then
+	// drain before RabbitMQ and the database are closed by the defers above
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	runWorker := func(name string, interval time.Duration, task func() error) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker.RunPeriodically(ctx, name, interval, task)
+		}()
+	}
+
+	runWorker("outbox relay", conf.OutboxConfig.RelayInterval, func() error {
+		_, err := serv.RelayOutbox()
+		return err
+	})
+
+	runWorker("job scheduler", conf.SchedulerConfig.Interval, func() error {
+		_, err := serv.EnqueueDueJobs()
+		return err
+	})
+
+	runWorker("idempotency key sweeper", conf.IdempotencyConfig.SweepInterval, func() error {
+		_, err := serv.PurgeExpiredIdempotencyKeys()
+		return err
+	})
+
+	runWorker("lease reaper", conf.ReaperConfig.Interval, func() error {
+		_, err := serv.ReapExpiredLeases()
+		return err
 	})
 
+	if conf.RetentionConfig.OriginalRetentionDays > 0 || conf.RetentionConfig.OutputRetentionDays > 0 {
+		runWorker("retention sweeper", conf.RetentionConfig.SweepInterval, func() error {
+			_, err := serv.PurgeExpiredFiles()
+			return err
+		})
+	}
+
+	if conf.ReconcileConfig.Interval > 0 {
+		runWorker("storage reconciler", conf.ReconcileConfig.Interval, func() error {
+			_, err := serv.ReconcileStorage(!conf.ReconcileConfig.AutoFix)
+			return err
+		})
+	}
+
 	router.Init(&router.InitRouterParams{
 		Service: serv,
 		Gn:      gn,
@@ -63,7 +132,47 @@ func Start(conf *config.Config) {
 
 	slog.Info(fmt.Sprintf("%s Publisher service starting on port: %s", logTagStartWebservice, conf.ServicePort))
 
-	if err = gn.Run(conf.ServicePort); err != nil {
-		slog.Error(fmt.Sprintf("%s starting service, cause: %+v", logTagStartWebservice, err))
+	server := &http.Server{
+		Addr:    conf.ServicePort,
+		Handler: gn,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(fmt.Sprintf("%s starting service, cause: %+v", logTagStartWebservice, err))
+		}
+		stop()
+	case <-ctx.Done():
+		slog.Info(fmt.Sprintf("%s shutdown signal received, draining for up to %s", logTagStartWebservice, conf.ShutdownTimeout))
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and let in-flight requests such as uploads finish
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error(fmt.Sprintf("%s shutting down http server: %v", logTagStartWebservice, err))
+	}
+
+	// Let the background workers finish their current run, so an outbox batch
+	// is either published or rolled back rather than cut off mid-way
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		slog.Error(fmt.Sprintf("%s background workers did not stop within %s", logTagStartWebservice, conf.ShutdownTimeout))
+	}
+
+	slog.Info(fmt.Sprintf("%s closing RabbitMQ and database connections", logTagStartWebservice))
 }
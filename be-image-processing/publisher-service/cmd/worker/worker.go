@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const logTagWorker = "[Worker]"
+
+// RunPeriodically runs task every interval until ctx is cancelled. Errors are
+// logged and do not stop the loop.
+func RunPeriodically(ctx context.Context, name string, interval time.Duration, task func() error) {
+	slog.Info(fmt.Sprintf("%s starting %s every %s", logTagWorker, name, interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info(fmt.Sprintf("%s stopping %s", logTagWorker, name))
+			return
+		case <-ticker.C:
+			if err := task(); err != nil {
+				slog.Error(fmt.Sprintf("%s %s failed: %v", logTagWorker, name, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is an error that carries the HTTP status the handler should respond with
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, format string, args ...any) error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+func BadRequest(format string, args ...any) error {
+	return New(http.StatusBadRequest, format, args...)
+}
+
+func NotFound(format string, args ...any) error {
+	return New(http.StatusNotFound, format, args...)
+}
+
+func Conflict(format string, args ...any) error {
+	return New(http.StatusConflict, format, args...)
+}
+
+func Gone(format string, args ...any) error {
+	return New(http.StatusGone, format, args...)
+}
+
+// Status returns the HTTP status carried by err, or fallback when err is not an *Error
+func Status(err error, fallback int) int {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+	return fallback
+}
@@ -0,0 +1,8 @@
+package config
+
+// BulkRetryConfig limits how fast a bulk retry or bulk reprocess re-enqueues
+// jobs, so a large requeue after an outage does not flood the queue at once
+type BulkRetryConfig struct {
+	// Rate is the number of jobs per second handed to the outbox relay
+	Rate float64 `json:"rate"`
+}
@@ -0,0 +1,7 @@
+package config
+
+// CacheConfig holds the Cache-Control policy sent with served images
+type CacheConfig struct {
+	UploadedCacheControl   string `json:"uploadedCacheControl"`
+	CompressedCacheControl string `json:"compressedCacheControl"`
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const slowChannelAcquire = 100 * time.Millisecond
+
+// channelPool hands out confirm-mode channels of the current connection to one
+// publisher at a time. At most size channels exist; callers beyond that wait.
+type channelPool struct {
+	slots chan struct{}
+
+	mu         sync.Mutex
+	conn       *amqp.Connection
+	generation uint64
+	idle       []*pooledChannel
+
+	acquires     atomic.Int64
+	timeouts     atomic.Int64
+	created      atomic.Int64
+	waitNanos    atomic.Int64
+	maxWaitNanos atomic.Int64
+}
+
+type pooledChannel struct {
+	channel    *amqp.Channel
+	returns    chan amqp.Return
+	generation uint64
+}
+
+// ChannelPoolStats describes how long publishers wait for a channel
+type ChannelPoolStats struct {
+	Size        int           `json:"size"`
+	InUse       int           `json:"inUse"`
+	Idle        int           `json:"idle"`
+	Acquires    int64         `json:"acquires"`
+	Timeouts    int64         `json:"timeouts"`
+	Created     int64         `json:"created"`
+	AverageWait time.Duration `json:"averageWait"`
+	MaxWait     time.Duration `json:"maxWait"`
+}
+
+func newChannelPool(size int) *channelPool {
+	return &channelPool{slots: make(chan struct{}, size)}
+}
+
+// reset switches the pool to a new connection. Channels of the previous
+// connection are closed when idle and dropped when released.
+func (p *channelPool) reset(conn *amqp.Connection) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pc := range p.idle {
+		pc.channel.Close()
+	}
+	p.idle = nil
+	p.conn = conn
+	p.generation++
+}
+
+// acquire waits for a free slot and returns an open channel for it
+func (p *channelPool) acquire(ctx context.Context) (*pooledChannel, error) {
+	started := time.Now()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.timeouts.Add(1)
+		return nil, fmt.Errorf("wait for publish channel: %w", ctx.Err())
+	}
+
+	p.recordWait(time.Since(started))
+
+	pc, err := p.take()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return pc, nil
+}
+
+// take reuses an idle channel of the current connection or opens a new one
+func (p *channelPool) take() (*pooledChannel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		pc := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if pc.generation == p.generation && !pc.channel.IsClosed() {
+			return pc, nil
+		}
+		pc.channel.Close()
+	}
+
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+
+	channel, err := p.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open publish channel: %w", err)
+	}
+
+	// Put the channel in confirm mode so every publish is acked or nacked
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+
+	p.created.Add(1)
+	return &pooledChannel{
+		channel: channel,
+		// Buffered so the library never blocks handing over a return; it is
+		// delivered before the confirm of the same message
+		returns:    channel.NotifyReturn(make(chan amqp.Return, 64)),
+		generation: p.generation,
+	}, nil
+}
+
+// release gives the channel back. Channels that may have an outstanding
+// confirm or belong to an old connection are closed instead of reused.
+func (p *channelPool) release(pc *pooledChannel, reusable bool) {
+	p.mu.Lock()
+	if reusable && pc.generation == p.generation && !pc.channel.IsClosed() {
+		p.idle = append(p.idle, pc)
+	} else {
+		pc.channel.Close()
+	}
+	p.mu.Unlock()
+
+	<-p.slots
+}
+
+func (p *channelPool) recordWait(wait time.Duration) {
+	p.acquires.Add(1)
+	p.waitNanos.Add(int64(wait))
+
+	for {
+		current := p.maxWaitNanos.Load()
+		if int64(wait) <= current || p.maxWaitNanos.CompareAndSwap(current, int64(wait)) {
+			break
+		}
+	}
+
+	if wait > slowChannelAcquire {
+		slog.Warn(fmt.Sprintf("waited %s for a publish channel, consider raising RABBITMQ_PUBLISH_CHANNELS", wait))
+	}
+}
+
+func (p *channelPool) stats() ChannelPoolStats {
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+
+	stats := ChannelPoolStats{
+		Size:     cap(p.slots),
+		InUse:    len(p.slots),
+		Idle:     idle,
+		Acquires: p.acquires.Load(),
+		Timeouts: p.timeouts.Load(),
+		Created:  p.created.Load(),
+		MaxWait:  time.Duration(p.maxWaitNanos.Load()),
+	}
+	if stats.Acquires > 0 {
+		stats.AverageWait = time.Duration(p.waitNanos.Load() / stats.Acquires)
+	}
+	return stats
+}
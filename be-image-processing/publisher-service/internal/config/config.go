@@ -5,17 +5,31 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"shared/messaging"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	ServiceName      string         `json:"serviceName"`
-	ServicePort      string         `json:"servicePort"`
-	GinMode          string         `json:"ginMode"`
-	Environment      Environment    `json:"environment"`
-	DatabaseConfig   DatabaseConfig `json:"databaseConfig"`
-	CorsAllowOrigins []string       `json:"corsAllowOrigins"`
-	RabbitMQConfig   RabbitMQConfig `json:"rabbitMQConfig"`
+	ServiceName       string            `json:"serviceName"`
+	ServicePort       string            `json:"servicePort"`
+	GinMode           string            `json:"ginMode"`
+	Environment       Environment       `json:"environment"`
+	DatabaseConfig    DatabaseConfig    `json:"databaseConfig"`
+	CorsAllowOrigins  []string          `json:"corsAllowOrigins"`
+	RabbitMQConfig    RabbitMQConfig    `json:"rabbitMQConfig"`
+	RetentionConfig   RetentionConfig   `json:"retentionConfig"`
+	ReconcileConfig   ReconcileConfig   `json:"reconcileConfig"`
+	CacheConfig       CacheConfig       `json:"cacheConfig"`
+	RenderConfig      RenderConfig      `json:"renderConfig"`
+	OutboxConfig      OutboxConfig      `json:"outboxConfig"`
+	ReaperConfig      ReaperConfig      `json:"reaperConfig"`
+	BulkRetryConfig   BulkRetryConfig   `json:"bulkRetryConfig"`
+	SchedulerConfig   SchedulerConfig   `json:"schedulerConfig"`
+	IdempotencyConfig IdempotencyConfig `json:"idempotencyConfig"`
+	ShutdownTimeout   time.Duration     `json:"shutdownTimeout"`
+	AdminToken        string            `json:"-"`
 }
 
 const logTagConifg = "[Init Config]"
@@ -35,8 +49,59 @@ func Init() {
 			DBName:   os.Getenv("DB_NAME"),
 		},
 		RabbitMQConfig: RabbitMQConfig{
-			RabbitMQUrl: os.Getenv("RABBITMQ_URL"),
+			RabbitMQUrl:     os.Getenv("RABBITMQ_URL"),
+			ConfirmTimeout:  getEnvDuration("RABBITMQ_CONFIRM_TIMEOUT", 5*time.Second),
+			PublishChannels: getEnvInt("RABBITMQ_PUBLISH_CHANNELS", 4),
 		},
+		RetentionConfig: RetentionConfig{
+			OriginalRetentionDays: getEnvInt("RETENTION_ORIGINAL_DAYS", 0),
+			OutputRetentionDays:   getEnvInt("RETENTION_OUTPUT_DAYS", 0),
+			KeepFailedOriginals:   getEnvBool("RETENTION_KEEP_FAILED_ORIGINALS", true),
+			SweepInterval:         getEnvDuration("RETENTION_SWEEP_INTERVAL", time.Hour),
+			SweepBatchSize:        getEnvInt("RETENTION_SWEEP_BATCH_SIZE", 500),
+		},
+		ReconcileConfig: ReconcileConfig{
+			Interval:    getEnvDuration("RECONCILE_INTERVAL", 0),
+			GracePeriod: getEnvDuration("RECONCILE_GRACE_PERIOD", time.Hour),
+			AutoFix:     getEnvBool("RECONCILE_AUTO_FIX", false),
+			BatchSize:   getEnvInt("RECONCILE_BATCH_SIZE", 500),
+		},
+		CacheConfig: CacheConfig{
+			UploadedCacheControl:   getEnv("CACHE_CONTROL_UPLOADED", "private, max-age=3600"),
+			CompressedCacheControl: getEnv("CACHE_CONTROL_COMPRESSED", "public, max-age=31536000, immutable"),
+		},
+		RenderConfig: RenderConfig{
+			AllowedSizes:     strings.Split(getEnv("RENDER_ALLOWED_SIZES", "160x160|320x240|640x480|1280x720"), "|"),
+			AllowedQualities: getEnvIntList("RENDER_ALLOWED_QUALITIES", []int{50, 70, 85}),
+			DefaultQuality:   getEnvInt("RENDER_DEFAULT_QUALITY", 70),
+			CacheDir:         getEnv("RENDER_CACHE_DIR", "cache/render"),
+			CacheMaxBytes:    int64(getEnvInt("RENDER_CACHE_MAX_MB", 512)) << 20,
+			CacheControl:     getEnv("CACHE_CONTROL_RENDER", "public, max-age=86400"),
+		},
+		OutboxConfig: OutboxConfig{
+			RelayInterval: getEnvDuration("OUTBOX_RELAY_INTERVAL", 500*time.Millisecond),
+			BatchSize:     getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			MaxAttempts:   getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		},
+		ReaperConfig: ReaperConfig{
+			Interval:   getEnvDuration("REAPER_INTERVAL", 30*time.Second),
+			BatchSize:  getEnvInt("REAPER_BATCH_SIZE", 100),
+			StaleAfter: getEnvDuration("REAPER_STALE_AFTER", 10*time.Minute),
+		},
+		BulkRetryConfig: BulkRetryConfig{
+			Rate: getEnvFloat("BULK_RETRY_RATE", 20),
+		},
+		SchedulerConfig: SchedulerConfig{
+			Interval:  getEnvDuration("SCHEDULER_INTERVAL", 30*time.Second),
+			BatchSize: getEnvInt("SCHEDULER_BATCH_SIZE", 100),
+		},
+		IdempotencyConfig: IdempotencyConfig{
+			TTL:           getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			LockTimeout:   getEnvDuration("IDEMPOTENCY_LOCK_TIMEOUT", 5*time.Minute),
+			SweepInterval: getEnvDuration("IDEMPOTENCY_SWEEP_INTERVAL", time.Hour),
+		},
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
 	}
 
 	if conf.ServiceName == "" {
@@ -66,6 +131,75 @@ func Init() {
 
 	conf.Environment = Environment(envString)
 
+	if conf.RetentionConfig.OriginalRetentionDays < 0 || conf.RetentionConfig.OutputRetentionDays < 0 {
+		log.Fatalf("%s retention days cannot be negative", logTagConifg)
+	}
+
+	if conf.RetentionConfig.SweepInterval <= 0 {
+		log.Fatalf("%s retention sweep interval must be positive, found: %s", logTagConifg, conf.RetentionConfig.SweepInterval)
+	}
+
+	if conf.RetentionConfig.SweepBatchSize <= 0 {
+		log.Fatalf("%s retention sweep batch size must be positive, found: %d", logTagConifg, conf.RetentionConfig.SweepBatchSize)
+	}
+
+	if conf.ReconcileConfig.Interval < 0 || conf.ReconcileConfig.GracePeriod < 0 {
+		log.Fatalf("%s reconcile interval and grace period cannot be negative", logTagConifg)
+	}
+
+	if conf.ReconcileConfig.BatchSize <= 0 {
+		log.Fatalf("%s reconcile batch size must be positive, found: %d", logTagConifg, conf.ReconcileConfig.BatchSize)
+	}
+
+	if conf.RenderConfig.CacheMaxBytes <= 0 {
+		log.Fatalf("%s render cache size must be positive", logTagConifg)
+	}
+
+	if conf.OutboxConfig.RelayInterval <= 0 || conf.OutboxConfig.BatchSize <= 0 || conf.OutboxConfig.MaxAttempts <= 0 {
+		log.Fatalf("%s outbox relay interval, batch size and max attempts must be positive", logTagConifg)
+	}
+
+	if conf.RabbitMQConfig.ConfirmTimeout <= 0 {
+		log.Fatalf("%s rabbitMQ confirm timeout must be positive", logTagConifg)
+	}
+	conf.OutboxConfig.ClaimTimeout = time.Duration(conf.OutboxConfig.BatchSize)*conf.RabbitMQConfig.ConfirmTimeout + time.Minute
+
+	if conf.RabbitMQConfig.PublishChannels <= 0 {
+		log.Fatalf("%s rabbitMQ publish channels must be positive", logTagConifg)
+	}
+
+	retryDelays, err := messaging.ParseRetryDelays(getEnv("RETRY_DELAYS", messaging.DefaultRetryDelays))
+	if err != nil {
+		log.Fatalf("%s %v", logTagConifg, err)
+	}
+	conf.ReaperConfig.RetryDelays = retryDelays
+
+	// Workers ack a message whose job is leased by another worker, trusting
+	// the reaper to requeue the job if that lease expires, so it cannot be off
+	if conf.ReaperConfig.Interval <= 0 || conf.ReaperConfig.BatchSize <= 0 || conf.ReaperConfig.StaleAfter <= 0 {
+		log.Fatalf("%s reaper interval, batch size and stale after must be positive", logTagConifg)
+	}
+
+	if conf.BulkRetryConfig.Rate <= 0 {
+		log.Fatalf("%s bulk retry rate must be positive, found: %g", logTagConifg, conf.BulkRetryConfig.Rate)
+	}
+
+	if conf.SchedulerConfig.Interval <= 0 || conf.SchedulerConfig.BatchSize <= 0 {
+		log.Fatalf("%s scheduler interval and batch size must be positive", logTagConifg)
+	}
+
+	if conf.IdempotencyConfig.TTL <= 0 || conf.IdempotencyConfig.LockTimeout <= 0 || conf.IdempotencyConfig.SweepInterval <= 0 {
+		log.Fatalf("%s idempotency TTL, lock timeout and sweep interval must be positive", logTagConifg)
+	}
+
+	if conf.ShutdownTimeout <= 0 {
+		log.Fatalf("%s shutdown timeout must be positive, found: %s", logTagConifg, conf.ShutdownTimeout)
+	}
+
+	if conf.AdminToken == "" {
+		slog.Warn(fmt.Sprintf("%s admin token is empty, admin endpoints are unprotected", logTagConifg))
+	}
+
 	corsOrigins := os.Getenv("CORS_ALLOW_ORIGINS")
 	conf.CorsAllowOrigins = strings.Split(corsOrigins, "|")
 	config = &conf
@@ -75,3 +209,85 @@ func Get() (conf *Config) {
 	conf = config
 	return
 }
+
+// getEnv reads a string environment variable, falling back when it is unset
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt reads an integer environment variable, falling back when it is unset
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s %s must be an integer, found: %s", logTagConifg, key, value)
+	}
+	return parsed
+}
+
+// getEnvFloat reads a floating point environment variable, falling back when it is unset
+func getEnvFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("%s %s must be a number, found: %s", logTagConifg, key, value)
+	}
+	return parsed
+}
+
+// getEnvIntList reads a "|" separated list of integers, falling back when it is unset
+func getEnvIntList(key string, fallback []int) []int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	var parsed []int
+	for _, item := range strings.Split(value, "|") {
+		number, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			log.Fatalf("%s %s must be a list of integers, found: %s", logTagConifg, key, value)
+		}
+		parsed = append(parsed, number)
+	}
+	return parsed
+}
+
+// getEnvBool reads a boolean environment variable, falling back when it is unset
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s %s must be a boolean, found: %s", logTagConifg, key, value)
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "30s", "1h"), falling back when it is unset
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s %s must be a duration, found: %s", logTagConifg, key, value)
+	}
+	return parsed
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/jobmessage"
+	"shared/messaging"
+)
+
+// DeadLetter is a message sitting in the failed_jobs queue together with the
+// failure context the worker attached to it
+type DeadLetter struct {
+	MessageID   string
+	JobID       *int64
+	Reason      string
+	Stage       string
+	Retryable   bool
+	Attempt     int
+	FailedAt    *time.Time
+	FailedBy    string
+	Redelivered bool
+	ContentType string
+	Body        []byte
+}
+
+// deadLetterFromDelivery reads the failure headers of a failed_jobs delivery
+func deadLetterFromDelivery(d amqp.Delivery) DeadLetter {
+	deadLetter := DeadLetter{
+		MessageID:   d.MessageId,
+		Redelivered: d.Redelivered,
+		ContentType: d.ContentType,
+		Body:        d.Body,
+	}
+
+	if message, err := jobmessage.Decode(d.ContentType, d.Body); err == nil {
+		deadLetter.JobID = &message.ID
+	}
+
+	deadLetter.Reason, _ = d.Headers[messaging.HeaderFailureReason].(string)
+	deadLetter.Stage, _ = d.Headers[messaging.HeaderFailureStage].(string)
+	deadLetter.FailedBy, _ = d.Headers[messaging.HeaderFailedBy].(string)
+	deadLetter.Retryable, _ = d.Headers[messaging.HeaderRetryable].(bool)
+
+	switch attempt := d.Headers[messaging.HeaderAttempt].(type) {
+	case int32:
+		deadLetter.Attempt = int(attempt)
+	case int64:
+		deadLetter.Attempt = int(attempt)
+	}
+
+	if failedAt, ok := d.Headers[messaging.HeaderFailedAt].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339, failedAt); err == nil {
+			deadLetter.FailedAt = &parsed
+		}
+	}
+
+	return deadLetter
+}
+
+// deadLetterChannel opens a plain channel for reading the failed_jobs queue
+func (r *RabbitMQ) deadLetterChannel() (*amqp.Channel, error) {
+	if !r.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	r.mu.RLock()
+	conn := r.conn
+	r.mu.RUnlock()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter channel: %w", err)
+	}
+	return channel, nil
+}
+
+// PeekDeadLetters returns up to limit messages from the head of the
+// failed_jobs queue without removing them, and the total queue depth. The
+// messages are fetched unacked and go back to the queue in their original
+// order when the channel closes.
+func (r *RabbitMQ) PeekDeadLetters(limit int) (deadLetters []DeadLetter, depth int, err error) {
+	channel, err := r.deadLetterChannel()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer channel.Close()
+
+	queue, err := channel.QueueInspect(messaging.QueueFailedJobs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("inspect %s: %w", messaging.QueueFailedJobs, err)
+	}
+
+	deadLetters = []DeadLetter{}
+	for len(deadLetters) < limit {
+		d, ok, err := channel.Get(messaging.QueueFailedJobs, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("get from %s: %w", messaging.QueueFailedJobs, err)
+		}
+		if !ok {
+			break
+		}
+		deadLetters = append(deadLetters, deadLetterFromDelivery(d))
+	}
+
+	return deadLetters, queue.Messages, nil
+}
+
+// TakeDeadLetters walks up to scanLimit messages of the failed_jobs queue and
+// calls take for each one match selects. Messages take handles without error
+// are acked and leave the queue; all others are returned to it.
+func (r *RabbitMQ) TakeDeadLetters(scanLimit int, match func(DeadLetter) bool, take func(DeadLetter) error) (taken int, err error) {
+	channel, err := r.deadLetterChannel()
+	if err != nil {
+		return 0, err
+	}
+	// Closing the channel requeues every message that was not acked
+	defer channel.Close()
+
+	for scanned := 0; scanned < scanLimit; scanned++ {
+		d, ok, err := channel.Get(messaging.QueueFailedJobs, false)
+		if err != nil {
+			return taken, fmt.Errorf("get from %s: %w", messaging.QueueFailedJobs, err)
+		}
+		if !ok {
+			break
+		}
+
+		deadLetter := deadLetterFromDelivery(d)
+		if !match(deadLetter) {
+			continue
+		}
+
+		if err := take(deadLetter); err != nil {
+			continue
+		}
+
+		if err := d.Ack(false); err != nil {
+			return taken, fmt.Errorf("ack dead letter %s: %w", d.MessageId, err)
+		}
+		taken++
+	}
+
+	return taken, nil
+}
+
+// PurgeDeadLetters removes every message from the failed_jobs queue
+func (r *RabbitMQ) PurgeDeadLetters() (purged int, err error) {
+	channel, err := r.deadLetterChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer channel.Close()
+
+	purged, err = channel.QueuePurge(messaging.QueueFailedJobs, false)
+	if err != nil {
+		return 0, fmt.Errorf("purge %s: %w", messaging.QueueFailedJobs, err)
+	}
+	return purged, nil
+}
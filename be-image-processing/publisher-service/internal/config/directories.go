@@ -7,10 +7,15 @@ import (
 	"path/filepath"
 )
 
+const (
+	UploadsDir    = "uploads"
+	CompressedDir = "compressed"
+)
+
 func InitializeDirectories() error {
 	dirs := []string{
-		"./uploads",
-		"./compressed",
+		UploadsDir,
+		CompressedDir,
 	}
 
 	for _, dir := range dirs {
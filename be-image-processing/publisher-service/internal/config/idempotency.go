@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// IdempotencyConfig controls how long responses stored under an
+// Idempotency-Key are replayed. A key whose request never finished, because
+// the publisher died mid-request, can be reused after LockTimeout.
+type IdempotencyConfig struct {
+	TTL           time.Duration `json:"ttl"`
+	LockTimeout   time.Duration `json:"lockTimeout"`
+	SweepInterval time.Duration `json:"sweepInterval"`
+}
@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+// OutboxConfig controls how often the outbox relay publishes pending job
+// messages and how many transient publish failures it tolerates before the
+// job is marked failed. A relay claims a batch for ClaimTimeout, long enough
+// for every message in it to wait out the publish confirm timeout; a batch
+// left behind by a relay that died is picked up again once it passes.
+type OutboxConfig struct {
+	RelayInterval time.Duration `json:"relayInterval"`
+	BatchSize     int           `json:"batchSize"`
+	MaxAttempts   int           `json:"maxAttempts"`
+	ClaimTimeout  time.Duration `json:"claimTimeout"`
+}
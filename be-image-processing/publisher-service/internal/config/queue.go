@@ -1,166 +1,310 @@
 package config
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/jobmessage"
+	"shared/messaging"
 )
 
-// RabbitMQ represents a connection to RabbitMQ
+var (
+	// ErrPublishNacked means the broker refused responsibility for the message
+	ErrPublishNacked = errors.New("broker nacked the message")
+	// ErrPublishReturned means the message matched no queue and came back as mandatory
+	ErrPublishReturned = errors.New("message was returned as unroutable")
+	// ErrPublishTimeout means no confirm arrived in time; the message may or may not be queued
+	ErrPublishTimeout = errors.New("timed out waiting for publisher confirm")
+	// ErrNotConnected means the connection is down and being re-established
+	ErrNotConnected = errors.New("rabbitMQ is not connected")
+)
+
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// RabbitMQ represents a connection to RabbitMQ. A supervisor goroutine watches
+// the connection and reconnects with backoff when it closes. Publishes go
+// through a bounded pool of confirm-mode channels, since a channel must not be
+// shared by concurrent publishers waiting on confirms.
 type RabbitMQ struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	queue   amqp.Queue
-}
+	url            string
+	confirmTimeout time.Duration
+	pool           *channelPool
+
+	// mu guards the fields replaced on every reconnect
+	mu    sync.RWMutex
+	conn  *amqp.Connection
+	queue amqp.Queue
 
-type JobMessage struct {
-	ID       int64  `json:"id"`
-	Filename string `json:"filename"`
+	connected atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 type RabbitMQConfig struct {
-	RabbitMQUrl string `json:"rabbitMQUrl"`
+	RabbitMQUrl     string        `json:"rabbitMQUrl"`
+	ConfirmTimeout  time.Duration `json:"confirmTimeout"`
+	PublishChannels int           `json:"publishChannels"`
 }
 
 type InitRabbitMQParams struct {
 	Conf *RabbitMQConfig
 }
 
+// InitRabbitMQ connects to RabbitMQ and starts the reconnect supervisor. When
+// the first attempt fails the error is returned together with a usable
+// RabbitMQ that keeps retrying in the background.
 func InitRabbitMQ(param *InitRabbitMQParams) (*RabbitMQ, error) {
+	r := &RabbitMQ{
+		url:            param.Conf.RabbitMQUrl,
+		confirmTimeout: param.Conf.ConfirmTimeout,
+		pool:           newChannelPool(param.Conf.PublishChannels),
+		done:           make(chan struct{}),
+	}
+
+	err := r.connect()
+	if err != nil {
+		go r.reconnect()
+		return r, err
+	}
+
+	log.Println("✅ Successfully connected to RabbitMQ with retry & DLQ setup")
+	return r, nil
+}
+
+// connect dials and declares the topology, then hands the connection to the
+// publish channel pool and the supervisor
+func (r *RabbitMQ) connect() error {
 	// Connect to RabbitMQ
-	conn, err := amqp.Dial(param.Conf.RabbitMQUrl)
+	conn, err := amqp.Dial(r.url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
-	channel, err := conn.Channel()
+	// Setup exchanges and queues
+	err = messaging.DeclareTopology(conn)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open a channel: %w", err)
+		return fmt.Errorf("failed to setup exchanges and queues: %w", err)
 	}
 
-	// Setup exchanges and queues
-	err = setupExchangesAndQueues(channel)
+	channel, err := conn.Channel()
 	if err != nil {
-		channel.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to setup exchanges and queues: %w", err)
+		return fmt.Errorf("failed to open a channel: %w", err)
 	}
 
 	// Inspect the already-declared queue (avoid re-declaration with wrong args)
-	queue, err := channel.QueueInspect("image_jobs")
+	queue, err := channel.QueueInspect(messaging.QueueImageJobs)
 	if err != nil {
 		channel.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to inspect main queue: %w", err)
+		return fmt.Errorf("failed to inspect main queue: %w", err)
 	}
 
-	log.Println("✅ Successfully connected to RabbitMQ with retry & DLQ setup")
-	return &RabbitMQ{conn: conn, channel: channel, queue: queue}, nil
+	// The setup channel is done; publishes use pooled channels
+	channel.Close()
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	r.mu.Lock()
+	r.conn = conn
+	r.queue = queue
+	r.mu.Unlock()
+	r.pool.reset(conn)
+	r.connected.Store(true)
+
+	go r.supervise(conn, connClosed)
+	return nil
 }
 
-func setupExchangesAndQueues(ch *amqp.Channel) error {
-	// Dead Letter Exchange
-	if err := ch.ExchangeDeclare("dead_letter_exchange", "direct", true, false, false, false, nil); err != nil {
-		return fmt.Errorf("declare DLX: %w", err)
+// supervise waits for the connection to close and reconnects. Closed pool
+// channels are replaced by the pool itself.
+func (r *RabbitMQ) supervise(conn *amqp.Connection, connClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case <-r.done:
+		return
+	case reason = <-connClosed:
 	}
 
-	// Retry Exchange
-	if err := ch.ExchangeDeclare("retry_exchange", "direct", true, false, false, false, nil); err != nil {
-		return fmt.Errorf("declare retry exchange: %w", err)
+	r.connected.Store(false)
+	log.Printf("⚠️ RabbitMQ connection lost: %v", reason)
+
+	r.reconnect()
+}
+
+// reconnect retries connect with exponential backoff until it succeeds or
+// Close is called
+func (r *RabbitMQ) reconnect() {
+	backoff := minReconnectBackoff
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if err := r.connect(); err != nil {
+			log.Printf("❌ RabbitMQ reconnect failed, retrying in %s: %v", backoff, err)
+			backoff = min(backoff*2, maxReconnectBackoff)
+			continue
+		}
+
+		log.Println("✅ Reconnected to RabbitMQ")
+		return
 	}
+}
 
-	// Retry Queue
-	_, err := ch.QueueDeclare(
-		"retry_queue",
-		true,
-		false,
-		false,
-		false,
-		amqp.Table{
-			"x-message-ttl":             int32(5000),  // 5s
-			"x-dead-letter-exchange":    "",           // default exchange
-			"x-dead-letter-routing-key": "image_jobs", // back to main
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("declare retry_queue: %w", err)
+// IsConnected reports whether the connection is currently up
+func (r *RabbitMQ) IsConnected() bool {
+	return r != nil && r.connected.Load()
+}
+
+// PoolStats reports publish channel pool usage and wait times
+func (r *RabbitMQ) PoolStats() ChannelPoolStats {
+	return r.pool.stats()
+}
+
+// Close stops the supervisor and closes the RabbitMQ connection and its channels
+func (r *RabbitMQ) Close() {
+	if r == nil {
+		return
 	}
-	if err := ch.QueueBind("retry_queue", "retry", "retry_exchange", false, nil); err != nil {
-		return fmt.Errorf("bind retry_queue: %w", err)
+	r.closeOnce.Do(func() { close(r.done) })
+	r.connected.Store(false)
+	r.pool.reset(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		r.conn.Close()
 	}
+}
 
-	// Failed Jobs Queue
-	_, err = ch.QueueDeclare(
-		"failed_jobs",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+// PublishJob sends a job message for attempt to the queue with the AMQP
+// priority matching the job's priority. Publishing the same messageID again
+// lets the subscriber recognise the copy as a duplicate.
+func (r *RabbitMQ) PublishJob(messageID string, jobID int64, filename string, attempt int, priority messaging.Priority) error {
+	if !r.IsConnected() {
+		return ErrNotConnected
+	}
+
+	publishing, err := jobPublishing(messageID, jobID, filename, attempt, priority)
 	if err != nil {
-		return fmt.Errorf("declare failed_jobs queue: %w", err)
+		return fmt.Errorf("publish job %d: %w", jobID, err)
 	}
-	if err := ch.QueueBind("failed_jobs", "failed_jobs", "dead_letter_exchange", false, nil); err != nil {
-		return fmt.Errorf("bind failed_jobs queue: %w", err)
+
+	r.mu.RLock()
+	queue := r.queue
+	r.mu.RUnlock()
+
+	// The timeout covers both waiting for a channel and waiting for the confirm
+	ctx, cancel := context.WithTimeout(context.Background(), r.confirmTimeout)
+	defer cancel()
+
+	pc, err := r.pool.acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("publish job %d: %w", jobID, err)
 	}
 
-	// Main Image Jobs Queue
-	_, err = ch.QueueDeclare(
-		"image_jobs",
-		true,
-		false,
-		false,
+	// A channel whose confirm never arrived is not reused, so a late confirm
+	// or return cannot be mistaken for a later publish
+	reusable := false
+	defer func() { r.pool.release(pc, reusable) }()
+
+	// Drop returns left over from earlier publishes on this channel
+	drainReturns(pc.returns)
+
+	confirmation, err := pc.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",         // default exchange
+		queue.Name, // routing key (messaging.QueueImageJobs)
+		true,       // mandatory: return the message if no queue takes it
 		false,
-		amqp.Table{
-			"x-dead-letter-exchange":    "retry_exchange",
-			"x-dead-letter-routing-key": "retry",
-		},
+		publishing,
 	)
 	if err != nil {
-		return fmt.Errorf("declare image_jobs queue: %w", err)
+		return fmt.Errorf("publish job: %w", err)
 	}
 
-	return nil
-}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("publish job %d: %w", jobID, ErrPublishTimeout)
+	}
+	reusable = true
 
-// Close closes the RabbitMQ connection and channel
-func (r *RabbitMQ) Close() {
-	if r.channel != nil {
-		r.channel.Close()
+	if returned, ok := takeReturn(pc.returns, messageID); ok {
+		return fmt.Errorf("publish job %d: %w: %d %s", jobID, ErrPublishReturned, returned.ReplyCode, returned.ReplyText)
 	}
-	if r.conn != nil {
-		r.conn.Close()
+
+	if !acked {
+		return fmt.Errorf("publish job %d: %w", jobID, ErrPublishNacked)
 	}
+
+	log.Printf("📤 Published job ID %d to queue '%s'", jobID, queue.Name)
+	return nil
 }
 
-// PublishJob sends a job message to the queue
-func (r *RabbitMQ) PublishJob(jobID int64, filename string) error {
-	message := JobMessage{ID: jobID, Filename: filename}
+// jobPublishing builds the message for attempt of a job in the schema of the
+// shared job message contract
+func jobPublishing(messageID string, jobID int64, filename string, attempt int, priority messaging.Priority) (amqp.Publishing, error) {
+	message := jobmessage.New(jobID, filename)
 
-	body, err := json.Marshal(message)
+	body, err := jobmessage.Encode(message)
 	if err != nil {
-		return fmt.Errorf("marshal job: %w", err)
+		return amqp.Publishing{}, err
 	}
 
-	err = r.channel.Publish(
-		"",           // default exchange
-		r.queue.Name, // routing key (image_jobs)
-		false,
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/json",
-			Body:         body,
+	return amqp.Publishing{
+		Headers: amqp.Table{
+			messaging.HeaderAttempt:        int32(attempt),
+			jobmessage.HeaderSchemaVersion: int32(message.SchemaVersion),
 		},
-	)
-	if err != nil {
-		return fmt.Errorf("publish job: %w", err)
+		DeliveryMode: amqp.Persistent,
+		Priority:     priority.Level(),
+		ContentType:  jobmessage.ContentType,
+		MessageId:    messageID,
+		Body:         body,
+	}, nil
+}
+
+// takeReturn reports whether the message with messageID was returned. The
+// broker sends basic.return before the confirm, so by the time the confirm
+// arrives the return is already buffered.
+func takeReturn(returns chan amqp.Return, messageID string) (amqp.Return, bool) {
+	for {
+		select {
+		case returned, ok := <-returns:
+			if !ok {
+				return amqp.Return{}, false
+			}
+			if returned.MessageId == messageID {
+				return returned, true
+			}
+		default:
+			return amqp.Return{}, false
+		}
 	}
+}
 
-	log.Printf("📤 Published job ID %d to queue '%s'", jobID, r.queue.Name)
-	return nil
+func drainReturns(returns chan amqp.Return) {
+	for {
+		select {
+		case _, ok := <-returns:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
 }
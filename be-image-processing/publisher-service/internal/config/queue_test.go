@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"shared/jobmessage"
+	"shared/messaging"
+)
+
+// The subscriber decodes job messages with the shared contract, so whatever
+// the publisher sends has to decode with it too.
+func TestJobPublishingFollowsContract(t *testing.T) {
+	publishing, err := jobPublishing("job-42-7", 42, "1700000000000000000_cat.jpg", 3, messaging.PriorityHigh)
+	if err != nil {
+		t.Fatalf("jobPublishing: %v", err)
+	}
+
+	message, err := jobmessage.Decode(publishing.ContentType, publishing.Body)
+	if err != nil {
+		t.Fatalf("subscriber cannot decode the published message: %v", err)
+	}
+	if message.ID != 42 || message.Filename != "1700000000000000000_cat.jpg" {
+		t.Errorf("decoded %+v, want job 42 with its filename", message)
+	}
+
+	if message.SchemaVersion != jobmessage.SchemaVersion {
+		t.Errorf("schema version = %d, want %d", message.SchemaVersion, jobmessage.SchemaVersion)
+	}
+	if version, _ := publishing.Headers[jobmessage.HeaderSchemaVersion].(int32); int(version) != message.SchemaVersion {
+		t.Errorf("%s header = %v, want the body's version %d", jobmessage.HeaderSchemaVersion, publishing.Headers[jobmessage.HeaderSchemaVersion], message.SchemaVersion)
+	}
+	if attempt, _ := publishing.Headers[messaging.HeaderAttempt].(int32); attempt != 3 {
+		t.Errorf("%s header = %v, want 3", messaging.HeaderAttempt, publishing.Headers[messaging.HeaderAttempt])
+	}
+	if publishing.MessageId != "job-42-7" {
+		t.Errorf("message ID = %q, want job-42-7", publishing.MessageId)
+	}
+}
@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// ReaperConfig controls the stuck-job reaper. Jobs whose lease expired get
+// another attempt after the retry delay for their attempt, until RetryDelays
+// runs out. Processing jobs without a lease, left by workers that predate
+// leases, count as expired once they have not been updated for StaleAfter.
+type ReaperConfig struct {
+	Interval    time.Duration   `json:"interval"`
+	BatchSize   int             `json:"batchSize"`
+	StaleAfter  time.Duration   `json:"staleAfter"`
+	RetryDelays []time.Duration `json:"retryDelays"`
+}
@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// ReconcileConfig controls the storage reconciliation job. An interval of zero
+// disables the periodic run; the admin endpoint is always available. Jobs and
+// directory entries are checked BatchSize at a time.
+type ReconcileConfig struct {
+	Interval    time.Duration `json:"interval"`
+	GracePeriod time.Duration `json:"gracePeriod"`
+	AutoFix     bool          `json:"autoFix"`
+	BatchSize   int           `json:"batchSize"`
+}
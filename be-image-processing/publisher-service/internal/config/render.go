@@ -0,0 +1,13 @@
+package config
+
+// RenderConfig controls the on-the-fly render endpoint. Only the listed sizes
+// and qualities are accepted so clients cannot fill the cache with arbitrary
+// variants.
+type RenderConfig struct {
+	AllowedSizes     []string `json:"allowedSizes"`
+	AllowedQualities []int    `json:"allowedQualities"`
+	DefaultQuality   int      `json:"defaultQuality"`
+	CacheDir         string   `json:"cacheDir"`
+	CacheMaxBytes    int64    `json:"cacheMaxBytes"`
+	CacheControl     string   `json:"cacheControl"`
+}
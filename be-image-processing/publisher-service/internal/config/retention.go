@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// RetentionConfig controls how long uploaded originals and compressed outputs
+// are kept on disk. A retention of zero days disables purging for that kind.
+type RetentionConfig struct {
+	OriginalRetentionDays int           `json:"originalRetentionDays"`
+	OutputRetentionDays   int           `json:"outputRetentionDays"`
+	KeepFailedOriginals   bool          `json:"keepFailedOriginals"`
+	SweepInterval         time.Duration `json:"sweepInterval"`
+	SweepBatchSize        int           `json:"sweepBatchSize"`
+}
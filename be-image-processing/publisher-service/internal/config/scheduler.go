@@ -0,0 +1,10 @@
+package config
+
+import "time"
+
+// SchedulerConfig controls how often the scheduler enqueues scheduled jobs
+// whose process_after has passed, and how many per run
+type SchedulerConfig struct {
+	Interval  time.Duration `json:"interval"`
+	BatchSize int           `json:"batchSize"`
+}
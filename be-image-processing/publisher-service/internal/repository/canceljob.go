@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"shared/jobstate"
+)
+
+// CancelJob cancels a job that is waiting for a worker and drops its unsent
+// outbox messages in one transaction. A processing job is flagged instead,
+// and its worker cancels it once the heartbeat notices. It returns the status
+// the job is in afterwards: cancelled, or processing while the worker aborts.
+func (r repository) CancelJob(id int64, actor, reason string) (jobstate.Status, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = jobstate.Transition(tx, id, jobstate.Change{
+		To:     jobstate.Cancelled,
+		From:   []jobstate.Status{jobstate.Pending, jobstate.Retrying, jobstate.Scheduled},
+		Actor:  actor,
+		Reason: reason,
+		Fields: []jobstate.Field{jobstate.Set("next_retry_at", nil)},
+	})
+
+	var illegal *jobstate.IllegalTransitionError
+	if errors.As(err, &illegal) && illegal.From == jobstate.Processing {
+		if err = jobstate.RequestCancel(tx, id); err != nil {
+			return "", fmt.Errorf("error requesting cancellation: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return "", fmt.Errorf("error committing cancellation request: %w", err)
+		}
+		return jobstate.Processing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error cancelling job: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE outbox
+		SET failed_at = NOW(), last_error = $2
+		WHERE job_id = $1 AND sent_at IS NULL AND failed_at IS NULL
+	`, id, "job cancelled")
+	if err != nil {
+		return "", fmt.Errorf("error dropping outbox messages: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing cancellation: %w", err)
+	}
+
+	return jobstate.Cancelled, nil
+}
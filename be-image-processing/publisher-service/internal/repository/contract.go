@@ -3,14 +3,45 @@ package repository
 import (
 	"database/sql"
 	"publisher-service/pkg/dto"
+	"shared/imaging"
+	"shared/jobstate"
+	"time"
 )
 
 type Repository interface {
-	CreateImageJob(filename string, originalSize int64) (int64, error)
-	UpdateJobStatus(id int64, status string) error
-	GetImageJobs() ([]dto.ImageJob, error)
+	CreateImageJob(filename string, originalSize int64, batchID, priority string, processAfter *time.Time) (int64, error)
+	GetImageJobs(priority string) ([]dto.ImageJob, error)
 	GetImageJob(id int64) (dto.ImageJob, error)
-	GetImageJobsByStatus(status string) ([]dto.ImageJob, error)
+	GetImageJobsByStatus(status, priority string) ([]dto.ImageJob, error)
+	GetImageJobByFilename(filename string) (dto.ImageJob, error)
+	GetImageJobByCompressedFileName(compressedFileName string) (dto.ImageJob, error)
+	GetOriginalsToPurge(before time.Time, includeFailed bool, limit int) ([]dto.ImageJob, error)
+	GetOutputsToPurge(before time.Time, limit int) ([]dto.ImageJob, error)
+	MarkOriginalPurged(id int64) error
+	MarkCompressedPurged(id int64) error
+	GetImageJobsAfter(afterID int64, limit int) ([]dto.ImageJob, error)
+	FindKnownUploads(names []string) (map[string]bool, error)
+	FindKnownOutputs(names []string, outputPrefix string) (map[string]bool, error)
+	FailJob(id int64, actor, reason string) error
+	RecordCompressedOutput(id int64, actor string, compressedFileName string, compressedSize int64) error
+	RequeueJob(id int64, from []jobstate.Status, pace time.Duration, actor, reason string) error
+	CancelJob(id int64, actor, reason string) (jobstate.Status, error)
+	FindJobs(filter dto.JobFilter) ([]dto.ImageJob, error)
+	DeleteJob(id int64) (dto.ImageJob, error)
+	ReprocessJob(id int64, opts imaging.Options, pace time.Duration, actor, reason string) (int, error)
+	GetSupersededOutputs(limit int) ([]dto.ImageJob, error)
+	ClearPreviousOutput(id int64, previousCompressedFileName string) error
+	Ping() error
+	RelayOutbox(limit int, claimFor time.Duration, publish func(message dto.OutboxMessage) (permanent bool, err error)) (int, error)
+	GetJobAttempts(jobID int64) ([]dto.JobAttempt, error)
+	GetJobEvents(jobID int64) ([]dto.JobEvent, error)
+	EnqueueDueJobs(limit int) ([]int64, error)
+	ClaimIdempotencyKey(key, requestHash, claimToken string, lockTimeout time.Duration) (bool, error)
+	GetIdempotencyKey(key string) (dto.IdempotencyKey, error)
+	SaveIdempotentResponse(key, claimToken string, response dto.IdempotentResponse, ttl time.Duration) error
+	DeleteIdempotencyKey(key, claimToken string) error
+	PurgeExpiredIdempotencyKeys() (int64, error)
+	ReapExpiredLeases(limit int, staleAfter time.Duration, decide func(job dto.ExpiredLease) (retry bool, delay time.Duration)) (dto.ReapResponse, error)
 }
 
 type repository struct {
@@ -2,20 +2,56 @@ package repository
 
 import (
 	"fmt"
+	"shared/jobstate"
+	"time"
 )
 
-func (r repository) CreateImageJob(filename string, originalSize int64) (int64, error) {
+// CreateImageJob inserts the job together with its outbox message in one
+// transaction, so a job row never exists without a pending publish. A job
+// with a processAfter in the future is created scheduled instead, without an
+// outbox message; the scheduler enqueues it once it is due.
+func (r repository) CreateImageJob(filename string, originalSize int64, batchID, priority string, processAfter *time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	status := jobstate.Pending
+	if processAfter != nil && processAfter.After(time.Now()) {
+		status = jobstate.Scheduled
+	}
+
 	query := `
-		INSERT INTO image_jobs (filename, original_size, status)
-		VALUES ($1, $2, 'pending')
+		INSERT INTO image_jobs (filename, original_size, status, batch_id, priority, process_after)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
 	`
 
 	var id int64
-	err := r.db.QueryRow(query, filename, originalSize).Scan(&id)
+	err = tx.QueryRow(query, filename, originalSize, string(status), batchID, priority, processAfter).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("error creating image job: %w", err)
 	}
 
+	if err = jobstate.RecordCreated(tx, id, status, actorUpload, "uploaded"); err != nil {
+		return 0, err
+	}
+
+	if status == jobstate.Scheduled {
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("error committing image job: %w", err)
+		}
+		return id, nil
+	}
+
+	if err = insertOutbox(tx, id); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing image job: %w", err)
+	}
+
 	return id, nil
 }
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+)
+
+// ErrJobInFlight is returned when a job cannot be deleted because a worker is
+// processing it or producing its pending revision
+var ErrJobInFlight = errors.New("job is being processed")
+
+// DeleteJob deletes the job row, along with its outbox messages, attempts and
+// events, and returns the deleted job so its files can be removed. A waiting
+// job is deleted as is; the worker skips its message once the row is gone. A
+// processing job, or a completed job whose pending revision a worker holds
+// the lease on, is not deleted, since the worker is still writing an output
+// the job's files would not include: its cancellation is requested instead
+// and ErrJobInFlight is returned.
+func (r repository) DeleteJob(id int64) (dto.ImageJob, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return dto.ImageJob{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	job, err := scanImageJob(tx.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.ImageJob{}, fmt.Errorf("error deleting job %d: %w", id, jobstate.ErrJobNotFound)
+	}
+	if err != nil {
+		return dto.ImageJob{}, fmt.Errorf("error fetching job: %w", err)
+	}
+
+	// A pending revision no worker holds is only waiting for one, and is
+	// deleted with the job
+	if job.Status == string(jobstate.Processing) || job.PendingRevision != nil {
+		err = jobstate.RequestCancel(tx, id)
+		if err == nil {
+			if err = tx.Commit(); err != nil {
+				return job, fmt.Errorf("error committing cancellation request: %w", err)
+			}
+			return job, fmt.Errorf("error deleting job %d: %w", id, ErrJobInFlight)
+		}
+		if !errors.Is(err, jobstate.ErrIllegalTransition) {
+			return job, fmt.Errorf("error requesting cancellation: %w", err)
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM image_jobs WHERE id = $1`, id); err != nil {
+		return job, fmt.Errorf("error deleting job: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return job, fmt.Errorf("error committing job deletion: %w", err)
+	}
+
+	return job, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"shared/jobstate"
+)
+
+const actorScheduler = "publisher:scheduler"
+
+// EnqueueDueJobs moves up to limit scheduled jobs whose process_after has
+// passed to pending and writes their outbox messages in one transaction. Jobs
+// locked by another publisher instance are skipped. It returns the IDs of the
+// enqueued jobs.
+func (r repository) EnqueueDueJobs(limit int) ([]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id
+		FROM image_jobs
+		WHERE status = $1 AND process_after <= NOW()
+		ORDER BY process_after, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.Query(query, string(jobstate.Scheduled), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due jobs: %w", err)
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning due job row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating due job rows: %w", err)
+	}
+
+	enqueued := []int64{}
+	for _, id := range ids {
+		_, err = jobstate.Transition(tx, id, jobstate.Change{
+			To:     jobstate.Pending,
+			From:   []jobstate.Status{jobstate.Scheduled},
+			Actor:  actorScheduler,
+			Reason: "scheduled time reached",
+		})
+		if errors.Is(err, jobstate.ErrIllegalTransition) {
+			continue
+		}
+		if err == nil {
+			err = insertOutbox(tx, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error enqueueing job %d: %w", id, err)
+		}
+		enqueued = append(enqueued, id)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing scheduler: %w", err)
+	}
+
+	return enqueued, nil
+}
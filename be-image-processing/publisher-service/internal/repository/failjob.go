@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"fmt"
+	"shared/jobstate"
+)
+
+func (r repository) FailJob(id int64, actor, reason string) error {
+	_, err := jobstate.Transition(r.db, id, jobstate.Change{
+		To:     jobstate.Failed,
+		Actor:  actor,
+		Reason: reason,
+		Fields: []jobstate.Field{jobstate.Set("error_message", reason)},
+	})
+	if err != nil {
+		return fmt.Errorf("error failing job: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"publisher-service/pkg/dto"
+	"strings"
+)
+
+// FindJobs returns up to filter.Limit jobs matching filter, oldest first
+func (r repository) FindJobs(filter dto.JobFilter) ([]dto.ImageJob, error) {
+	where, args := jobFilterClause(filter)
+
+	args = append(args, filter.Limit)
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE ` + where + `
+		ORDER BY id
+		LIMIT $` + fmt.Sprint(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs by filter: %w", err)
+	}
+
+	return scanImageJobs(rows)
+}
+
+// jobFilterClause builds the WHERE condition for filter and its arguments
+func jobFilterClause(filter dto.JobFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.IDs) > 0 {
+		add("id = ANY($%d)", pq.Array(filter.IDs))
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.ErrorContains != "" {
+		add("strpos(lower(error_message), lower($%d)) > 0", filter.ErrorContains)
+	}
+	if filter.BatchID != "" {
+		add("batch_id = $%d", filter.BatchID)
+	}
+	if filter.Priority != "" {
+		add("priority = $%d", filter.Priority)
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < $%d", *filter.CreatedBefore)
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(conditions, " AND "), args
+}
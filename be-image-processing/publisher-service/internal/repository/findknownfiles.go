@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// FindKnownUploads returns which of names are the original of a job
+func (r repository) FindKnownUploads(names []string) (map[string]bool, error) {
+	query := `
+		SELECT name
+		FROM unnest($1::text[]) AS name
+		WHERE EXISTS (SELECT 1 FROM image_jobs j WHERE j.filename = name)
+	`
+
+	rows, err := r.db.Query(query, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("error querying known uploads: %w", err)
+	}
+
+	return scanNames(rows)
+}
+
+// FindKnownOutputs returns which of names are the current or previous output
+// of a job, or the unrecorded output of a job still being processed that has
+// none recorded. Outputs of finished jobs are only known once recorded.
+func (r repository) FindKnownOutputs(names []string, outputPrefix string) (map[string]bool, error) {
+	query := `
+		SELECT name
+		FROM unnest($1::text[]) AS name
+		WHERE EXISTS (
+		        SELECT 1 FROM image_jobs j
+		        WHERE j.compressed_file_name = name OR j.previous_compressed_file_name = name
+		      )
+		   OR (left(name, length($2)) = $2 AND EXISTS (
+		        SELECT 1 FROM image_jobs j
+		        WHERE j.filename = substr(name, length($2) + 1)
+		          AND j.compressed_file_name IS NULL
+		          AND j.status IN ('pending', 'processing', 'retrying')
+		      ))
+	`
+
+	rows, err := r.db.Query(query, pq.Array(names), outputPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error querying known outputs: %w", err)
+	}
+
+	return scanNames(rows)
+}
+
+func scanNames(rows *sql.Rows) (map[string]bool, error) {
+	defer rows.Close()
+
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning name: %w", err)
+		}
+		names[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating names: %w", err)
+	}
+
+	return names, nil
+}
@@ -7,18 +7,12 @@ import (
 
 func (r repository) GetImageJob(id int64) (dto.ImageJob, error) {
 	query := `
-		SELECT id, filename, original_size, compressed_size, compressed_file_name,
-			   status, error_message, created_at, updated_at
+		SELECT ` + imageJobColumns + `
 		FROM image_jobs
 		WHERE id = $1
 	`
 
-	var job dto.ImageJob
-	err := r.db.QueryRow(query, id).Scan(
-		&job.ID, &job.Filename, &job.OriginalSize, &job.CompressedSize,
-		&job.CompressedFileName, &job.Status, &job.ErrorMessage,
-		&job.CreatedAt, &job.UpdatedAt,
-	)
+	job, err := scanImageJob(r.db.QueryRow(query, id))
 	if err != nil {
 		return dto.ImageJob{}, fmt.Errorf("error getting image job: %w", err)
 	}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"fmt"
+	"publisher-service/pkg/dto"
+)
+
+func (r repository) GetImageJobByFilename(filename string) (dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE filename = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	job, err := scanImageJob(r.db.QueryRow(query, filename))
+	if err != nil {
+		return dto.ImageJob{}, fmt.Errorf("error getting image job by filename: %w", err)
+	}
+
+	return job, nil
+}
+
+func (r repository) GetImageJobByCompressedFileName(compressedFileName string) (dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE compressed_file_name = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	job, err := scanImageJob(r.db.QueryRow(query, compressedFileName))
+	if err != nil {
+		return dto.ImageJob{}, fmt.Errorf("error getting image job by compressed file name: %w", err)
+	}
+
+	return job, nil
+}
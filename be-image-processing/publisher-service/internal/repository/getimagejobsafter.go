@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"fmt"
+	"publisher-service/pkg/dto"
+)
+
+// GetImageJobsAfter returns up to limit jobs with an ID above afterID in ID
+// order, for walking every job a page at a time
+func (r repository) GetImageJobsAfter(afterID int64, limit int) ([]dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying image jobs: %w", err)
+	}
+
+	return scanImageJobs(rows)
+}
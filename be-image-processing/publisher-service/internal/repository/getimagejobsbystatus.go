@@ -5,39 +5,21 @@ import (
 	"publisher-service/pkg/dto"
 )
 
-func (r repository) GetImageJobsByStatus(status string) ([]dto.ImageJob, error) {
+// GetImageJobsByStatus returns the latest jobs in status, only those of
+// priority unless it is empty
+func (r repository) GetImageJobsByStatus(status, priority string) ([]dto.ImageJob, error) {
 	query := `
-		SELECT id, filename, original_size, compressed_size, compressed_file_name,
-			   status, error_message, created_at, updated_at
+		SELECT ` + imageJobColumns + `
 		FROM image_jobs
-		WHERE status = $1
+		WHERE status = $1 AND ($2 = '' OR priority = $2)
 		ORDER BY created_at DESC
 		LIMIT 100
 	`
 
-	rows, err := r.db.Query(query, status)
+	rows, err := r.db.Query(query, status, priority)
 	if err != nil {
 		return nil, fmt.Errorf("error querying image jobs by status: %w", err)
 	}
-	defer rows.Close()
 
-	var jobs []dto.ImageJob
-	for rows.Next() {
-		var job dto.ImageJob
-		err := rows.Scan(
-			&job.ID, &job.Filename, &job.OriginalSize, &job.CompressedSize,
-			&job.CompressedFileName, &job.Status, &job.ErrorMessage,
-			&job.CreatedAt, &job.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning image job row: %w", err)
-		}
-		jobs = append(jobs, job)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating image job rows: %w", err)
-	}
-
-	return jobs, nil
+	return scanImageJobs(rows)
 }
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"publisher-service/pkg/dto"
+	"time"
+)
+
+// GetOriginalsToPurge returns jobs whose uploaded original is older than the
+// retention cutoff. Cancelled jobs count from when they were cancelled; failed
+// jobs are only included when includeFailed is set.
+func (r repository) GetOriginalsToPurge(before time.Time, includeFailed bool, limit int) ([]dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE original_purged_at IS NULL
+		  AND (
+		        (status = 'completed' AND completed_at < $1)
+		     OR (status = 'cancelled' AND updated_at < $1)
+		     OR ($2 AND status = 'failed' AND updated_at < $1)
+		  )
+		ORDER BY id
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, before, includeFailed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying originals to purge: %w", err)
+	}
+
+	return scanImageJobs(rows)
+}
+
+// GetOutputsToPurge returns completed jobs whose compressed output is older
+// than the retention cutoff.
+func (r repository) GetOutputsToPurge(before time.Time, limit int) ([]dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE compressed_purged_at IS NULL
+		  AND compressed_file_name IS NOT NULL
+		  AND status = 'completed'
+		  AND completed_at < $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outputs to purge: %w", err)
+	}
+
+	return scanImageJobs(rows)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"fmt"
+	"publisher-service/pkg/dto"
+)
+
+func (r repository) GetJobAttempts(jobID int64) ([]dto.JobAttempt, error) {
+	query := `
+		SELECT id, job_id, attempt, worker_id, started_at, finished_at,
+		       outcome, stage, error, duration_ms
+		FROM image_job_attempts
+		WHERE job_id = $1
+		ORDER BY started_at, id
+	`
+
+	rows, err := r.db.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying job attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []dto.JobAttempt{}
+	for rows.Next() {
+		var attempt dto.JobAttempt
+		err := rows.Scan(
+			&attempt.ID, &attempt.JobID, &attempt.Attempt, &attempt.WorkerID,
+			&attempt.StartedAt, &attempt.FinishedAt,
+			&attempt.Outcome, &attempt.Stage, &attempt.Error, &attempt.DurationMs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning job attempt row: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job attempt rows: %w", err)
+	}
+
+	return attempts, nil
+}
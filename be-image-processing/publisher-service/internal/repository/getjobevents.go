@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"fmt"
+	"publisher-service/pkg/dto"
+)
+
+func (r repository) GetJobEvents(jobID int64) ([]dto.JobEvent, error) {
+	query := `
+		SELECT id, job_id, from_status, to_status, actor, reason, created_at
+		FROM image_job_events
+		WHERE job_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying job events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []dto.JobEvent{}
+	for rows.Next() {
+		var event dto.JobEvent
+		err := rows.Scan(
+			&event.ID, &event.JobID, &event.FromStatus, &event.ToStatus,
+			&event.Actor, &event.Reason, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning job event row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job event rows: %w", err)
+	}
+
+	return events, nil
+}
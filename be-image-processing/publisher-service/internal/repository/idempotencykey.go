@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"time"
+)
+
+// ErrIdempotencyClaimLost is returned when a key is no longer claimed by the
+// request finishing under it: the claim expired and another request, possibly
+// a retry of the same one, took the key, or a response was already stored.
+var ErrIdempotencyClaimLost = errors.New("idempotency key is no longer claimed by this request")
+
+// ClaimIdempotencyKey stores key for a request with requestHash under
+// claimToken until lockTimeout passes. A key that exists and has not expired
+// is left alone, and false is returned.
+func (r repository) ClaimIdempotencyKey(key, requestHash, claimToken string, lockTimeout time.Duration) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (idempotency_key, request_hash, claim_token, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 millisecond')
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+		    claim_token = EXCLUDED.claim_token,
+		    response_status = NULL,
+		    response_content_type = NULL,
+		    response_body = NULL,
+		    created_at = NOW(),
+		    expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING idempotency_key
+	`
+
+	var claimed string
+	err := r.db.QueryRow(query, key, requestHash, claimToken, lockTimeout.Milliseconds()).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error claiming idempotency key: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetIdempotencyKey returns key unless it has expired
+func (r repository) GetIdempotencyKey(key string) (dto.IdempotencyKey, error) {
+	query := `
+		SELECT idempotency_key, request_hash, response_status, COALESCE(response_content_type, ''), response_body
+		FROM idempotency_keys
+		WHERE idempotency_key = $1 AND expires_at > NOW()
+	`
+
+	var (
+		idempotencyKey dto.IdempotencyKey
+		status         sql.NullInt64
+		contentType    string
+		body           []byte
+	)
+	err := r.db.QueryRow(query, key).Scan(&idempotencyKey.Key, &idempotencyKey.RequestHash, &status, &contentType, &body)
+	if err != nil {
+		return dto.IdempotencyKey{}, err
+	}
+
+	if status.Valid {
+		idempotencyKey.Response = &dto.IdempotentResponse{
+			Status:      int(status.Int64),
+			ContentType: contentType,
+			Body:        body,
+		}
+	}
+
+	return idempotencyKey, nil
+}
+
+// SaveIdempotentResponse stores the response of the request that claimed key
+// under claimToken and keeps it for ttl. A key claimed by another request, or
+// already answered, is left alone and ErrIdempotencyClaimLost is returned.
+func (r repository) SaveIdempotentResponse(key, claimToken string, response dto.IdempotentResponse, ttl time.Duration) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response_status = $3,
+		    response_content_type = $4,
+		    response_body = $5,
+		    expires_at = NOW() + $6 * INTERVAL '1 millisecond'
+		WHERE idempotency_key = $1 AND claim_token = $2 AND response_status IS NULL
+	`
+
+	result, err := r.db.Exec(query, key, claimToken, response.Status, response.ContentType, response.Body, ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("error saving idempotent response: %w", err)
+	}
+
+	return claimHeld(result)
+}
+
+// DeleteIdempotencyKey releases a key whose request, claimed under
+// claimToken, failed, so the client can retry it. A key claimed by another
+// request, or already answered, is left alone and ErrIdempotencyClaimLost is
+// returned.
+func (r repository) DeleteIdempotencyKey(key, claimToken string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE idempotency_key = $1 AND claim_token = $2 AND response_status IS NULL
+	`
+
+	result, err := r.db.Exec(query, key, claimToken)
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency key: %w", err)
+	}
+
+	return claimHeld(result)
+}
+
+func claimHeld(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdempotencyClaimLost
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes expired keys and returns how many
+func (r repository) PurgeExpiredIdempotencyKeys() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"fmt"
+)
+
+func (r repository) MarkOriginalPurged(id int64) error {
+	query := `
+		UPDATE image_jobs
+		SET original_purged_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("error marking original purged: %w", err)
+	}
+
+	return nil
+}
+
+func (r repository) MarkCompressedPurged(id int64) error {
+	query := `
+		UPDATE image_jobs
+		SET compressed_purged_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("error marking compressed output purged: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"slices"
+	"time"
+)
+
+const (
+	maxOutboxBackoff = 5 * time.Minute
+
+	actorUpload      = "publisher:upload"
+	actorOutboxRelay = "publisher:outbox-relay"
+)
+
+func insertOutbox(tx *sql.Tx, jobID int64) error {
+	return insertDelayedOutbox(tx, jobID, 1, 0)
+}
+
+// insertDelayedOutbox queues a message for attempt of the job that the relay
+// publishes once delay has passed
+func insertDelayedOutbox(tx *sql.Tx, jobID int64, jobAttempt int, delay time.Duration) error {
+	query := `
+		INSERT INTO outbox (job_id, job_attempt, available_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond')
+	`
+
+	_, err := tx.Exec(query, jobID, jobAttempt, delay.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("error inserting outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// outboxPacingLock is the advisory lock that serializes taking pacing slots
+const outboxPacingLock = 7245001
+
+// insertPacedOutbox queues a message for attempt of the job in the next free
+// pacing slot, interval after the latest slot any bulk request took, so all
+// bulk requests together stay within one rate. Without an interval the
+// message is available right away.
+func insertPacedOutbox(tx *sql.Tx, jobID int64, jobAttempt int, interval time.Duration) error {
+	if interval <= 0 {
+		return insertDelayedOutbox(tx, jobID, jobAttempt, 0)
+	}
+
+	// Held until the transaction ends, so concurrent requests cannot take the same slot
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, outboxPacingLock); err != nil {
+		return fmt.Errorf("error locking outbox pacing: %w", err)
+	}
+
+	query := `
+		WITH slot AS (
+			SELECT GREATEST(NOW(), COALESCE(MAX(paced_at) + $3 * INTERVAL '1 millisecond', NOW())) AS at
+			FROM outbox
+			WHERE paced_at IS NOT NULL
+		)
+		INSERT INTO outbox (job_id, job_attempt, available_at, paced_at)
+		SELECT $1, $2, slot.at, slot.at FROM slot
+	`
+
+	_, err := tx.Exec(query, jobID, jobAttempt, interval.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("error inserting outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// RequeueJob resets a job in one of the from statuses to pending and writes
+// a new outbox message in one transaction. With a pace the message takes the
+// next pacing slot, otherwise the relay publishes it right away.
+func (r repository) RequeueJob(id int64, from []jobstate.Status, pace time.Duration, actor, reason string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = jobstate.Transition(tx, id, jobstate.Change{
+		To:     jobstate.Pending,
+		From:   from,
+		Actor:  actor,
+		Reason: reason,
+		Fields: []jobstate.Field{
+			jobstate.Set("error_message", nil),
+			jobstate.Set("next_retry_at", nil),
+			jobstate.Set("cancel_requested_at", nil),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error requeueing job: %w", err)
+	}
+
+	if err = insertPacedOutbox(tx, id, 1, pace); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing requeue: %w", err)
+	}
+
+	return nil
+}
+
+// RelayOutbox claims up to limit due outbox messages for claimFor, hands each
+// to publish and marks it sent, or schedules a retry with backoff when publish
+// fails. When publish reports the failure as permanent, the message is given
+// up and its job is marked failed with the reason in the same transaction, or
+// for a reprocessed job, its pending revision is given up.
+// No transaction is held while publishing: the claim only moves the messages'
+// available_at past claimFor, so other publisher instances skip them, and a
+// relay that dies mid-batch leaves them to be claimed again once it passes.
+// A message published again that way keeps its ID, so the subscriber drops
+// the copy.
+func (r repository) RelayOutbox(limit int, claimFor time.Duration, publish func(message dto.OutboxMessage) (permanent bool, err error)) (int, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL AND available_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o
+		SET available_at = NOW() + $2 * INTERVAL '1 millisecond'
+		FROM due, image_jobs j
+		WHERE o.id = due.id AND j.id = o.job_id
+		RETURNING o.id, o.job_id, j.filename, o.attempts, o.job_attempt, j.priority
+	`
+
+	rows, err := r.db.Query(query, limit, claimFor.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("error claiming outbox messages: %w", err)
+	}
+
+	var messages []dto.OutboxMessage
+	for rows.Next() {
+		var message dto.OutboxMessage
+		if err := rows.Scan(&message.ID, &message.JobID, &message.Filename, &message.Attempts, &message.JobAttempt, &message.Priority); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning outbox row: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating outbox rows: %w", err)
+	}
+
+	// Claimed rows come back in no particular order
+	slices.SortFunc(messages, func(a, b dto.OutboxMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	sent := 0
+	for _, message := range messages {
+		permanent, publishErr := publish(message)
+		if publishErr != nil && permanent {
+			if err = r.failOutboxMessage(message, publishErr); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if publishErr != nil {
+			backoff := min(time.Duration(1<<min(message.Attempts, 16))*time.Second, maxOutboxBackoff)
+			_, err = r.db.Exec(`
+				UPDATE outbox
+				SET attempts = attempts + 1, last_error = $2, available_at = NOW() + $3 * INTERVAL '1 second'
+				WHERE id = $1 AND sent_at IS NULL
+			`, message.ID, publishErr.Error(), backoff.Seconds())
+			if err != nil {
+				return sent, fmt.Errorf("error recording outbox failure: %w", err)
+			}
+			continue
+		}
+
+		_, err = r.db.Exec(`
+			UPDATE outbox
+			SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL
+			WHERE id = $1 AND sent_at IS NULL
+		`, message.ID)
+		if err != nil {
+			return sent, fmt.Errorf("error marking outbox message sent: %w", err)
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// failOutboxMessage gives up on a message and fails its job, or the job's
+// pending revision, in one transaction
+func (r repository) failOutboxMessage(message dto.OutboxMessage, publishErr error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, failed_at = NOW()
+		WHERE id = $1
+	`, message.ID, publishErr.Error())
+	if err != nil {
+		return fmt.Errorf("error recording outbox failure: %w", err)
+	}
+
+	reason := "failed to enqueue job: " + publishErr.Error()
+	_, err = jobstate.Transition(tx, message.JobID, jobstate.Change{
+		To:     jobstate.Failed,
+		Actor:  actorOutboxRelay,
+		Reason: reason,
+		Fields: []jobstate.Field{jobstate.Set("error_message", reason)},
+	})
+	// A job a worker already moved on is left as it is
+	if err != nil && !errors.Is(err, jobstate.ErrIllegalTransition) {
+		return fmt.Errorf("error failing job after publish failure: %w", err)
+	}
+
+	// A completed job keeps its output; only the revision it was reprocessed into is given up
+	_, err = tx.Exec(`
+		UPDATE image_jobs
+		SET pending_revision = NULL, pending_processing_options = NULL, revision_error = $2, updated_at = NOW()
+		WHERE id = $1 AND status = $3 AND pending_revision IS NOT NULL
+	`, message.JobID, reason, string(jobstate.Completed))
+	if err != nil {
+		return fmt.Errorf("error giving up pending revision after publish failure: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing outbox failure: %w", err)
+	}
+
+	return nil
+}
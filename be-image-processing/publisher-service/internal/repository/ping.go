@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"fmt"
+)
+
+func (r repository) Ping() error {
+	if err := r.db.Ping(); err != nil {
+		return fmt.Errorf("error pinging database: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"time"
+)
+
+const actorReaper = "publisher:reaper"
+
+// ReapExpiredLeases locks up to limit processing jobs whose lease expired, or
+// that have no lease and were last updated before staleAfter ago, and asks
+// decide what to do with each. A job that gets a retry moves to retrying with
+// an outbox message for its next attempt delayed by the returned delay;
+// otherwise it is failed. Jobs whose cancellation was requested are cancelled
+// without asking decide, since their worker never got to do it. Jobs locked
+// by another reaper are skipped.
+func (r repository) ReapExpiredLeases(limit int, staleAfter time.Duration, decide func(job dto.ExpiredLease) (retry bool, delay time.Duration)) (dto.ReapResponse, error) {
+	reapResponse := dto.ReapResponse{Requeued: []int64{}, Failed: []int64{}, Cancelled: []int64{}}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return reapResponse, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, attempt, COALESCE(lease_owner, ''), lease_expires_at, cancel_requested_at IS NOT NULL
+		FROM image_jobs
+		WHERE status = $1
+		  AND (lease_expires_at < NOW()
+		       OR (lease_expires_at IS NULL AND updated_at < NOW() - $2 * INTERVAL '1 millisecond'))
+		ORDER BY lease_expires_at NULLS FIRST, id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.Query(query, string(jobstate.Processing), staleAfter.Milliseconds(), limit)
+	if err != nil {
+		return reapResponse, fmt.Errorf("error querying expired leases: %w", err)
+	}
+
+	var jobs []dto.ExpiredLease
+	for rows.Next() {
+		var job dto.ExpiredLease
+		if err := rows.Scan(&job.JobID, &job.Attempt, &job.LeaseOwner, &job.LeaseExpiresAt, &job.CancelRequested); err != nil {
+			rows.Close()
+			return reapResponse, fmt.Errorf("error scanning expired lease row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return reapResponse, fmt.Errorf("error iterating expired lease rows: %w", err)
+	}
+
+	for _, job := range jobs {
+		to, reason, delay := reapOutcome(job, decide)
+
+		switch to {
+		case jobstate.Cancelled:
+			_, err = jobstate.Transition(tx, job.JobID, jobstate.Change{
+				To:     jobstate.Cancelled,
+				From:   []jobstate.Status{jobstate.Processing},
+				Actor:  actorReaper,
+				Reason: reason,
+			})
+			if err != nil && !errors.Is(err, jobstate.ErrIllegalTransition) {
+				return reapResponse, fmt.Errorf("error cancelling job %d: %w", job.JobID, err)
+			}
+			if err == nil {
+				reapResponse.Cancelled = append(reapResponse.Cancelled, job.JobID)
+			}
+		case jobstate.Retrying:
+			_, err = jobstate.Transition(tx, job.JobID, jobstate.Change{
+				To:     jobstate.Retrying,
+				From:   []jobstate.Status{jobstate.Processing},
+				Actor:  actorReaper,
+				Reason: reason,
+				Fields: []jobstate.Field{
+					jobstate.Set("error_message", reason),
+					jobstate.SetExpr("next_retry_at", fmt.Sprintf("NOW() + INTERVAL '%d milliseconds'", delay.Milliseconds())),
+				},
+			})
+			if err == nil {
+				err = insertDelayedOutbox(tx, job.JobID, job.Attempt+1, delay)
+			}
+			if err != nil && !errors.Is(err, jobstate.ErrIllegalTransition) {
+				return reapResponse, fmt.Errorf("error requeueing job %d: %w", job.JobID, err)
+			}
+			if err == nil {
+				reapResponse.Requeued = append(reapResponse.Requeued, job.JobID)
+			}
+		default:
+			_, err = jobstate.Transition(tx, job.JobID, jobstate.Change{
+				To:     jobstate.Failed,
+				From:   []jobstate.Status{jobstate.Processing},
+				Actor:  actorReaper,
+				Reason: reason,
+				Fields: []jobstate.Field{jobstate.Set("error_message", reason)},
+			})
+			if err != nil && !errors.Is(err, jobstate.ErrIllegalTransition) {
+				return reapResponse, fmt.Errorf("error failing job %d: %w", job.JobID, err)
+			}
+			if err == nil {
+				reapResponse.Failed = append(reapResponse.Failed, job.JobID)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return dto.ReapResponse{Requeued: []int64{}, Failed: []int64{}, Cancelled: []int64{}}, fmt.Errorf("error committing reaper: %w", err)
+	}
+
+	return reapResponse, nil
+}
+
+// reapOutcome picks the status an expired job moves to and the reason
+// recorded with it. Jobs whose cancellation was requested are cancelled
+// without asking decide; the rest are retried after the returned delay or
+// failed.
+func reapOutcome(job dto.ExpiredLease, decide func(job dto.ExpiredLease) (retry bool, delay time.Duration)) (to jobstate.Status, reason string, delay time.Duration) {
+	reason = "lease expired"
+	if job.LeaseOwner != "" {
+		reason = fmt.Sprintf("lease held by %s expired", job.LeaseOwner)
+	}
+
+	if job.CancelRequested {
+		return jobstate.Cancelled, reason + " while cancelling", 0
+	}
+
+	if retry, delay := decide(job); retry {
+		return jobstate.Retrying, reason, delay
+	}
+	return jobstate.Failed, fmt.Sprintf("%s after %d attempts", reason, job.Attempt), 0
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+)
+
+func TestReapOutcome(t *testing.T) {
+	retryFirstAttempt := func(job dto.ExpiredLease) (bool, time.Duration) {
+		return job.Attempt == 1, 30 * time.Second
+	}
+
+	tests := []struct {
+		name       string
+		job        dto.ExpiredLease
+		wantTo     jobstate.Status
+		wantReason string
+		wantDelay  time.Duration
+	}{
+		{
+			name:       "retry granted",
+			job:        dto.ExpiredLease{JobID: 1, Attempt: 1, LeaseOwner: "worker-a"},
+			wantTo:     jobstate.Retrying,
+			wantReason: "lease held by worker-a expired",
+			wantDelay:  30 * time.Second,
+		},
+		{
+			name:       "retries exhausted",
+			job:        dto.ExpiredLease{JobID: 1, Attempt: 2, LeaseOwner: "worker-a"},
+			wantTo:     jobstate.Failed,
+			wantReason: "lease held by worker-a expired after 2 attempts",
+		},
+		{
+			name:       "stale job without a lease",
+			job:        dto.ExpiredLease{JobID: 1, Attempt: 2},
+			wantTo:     jobstate.Failed,
+			wantReason: "lease expired after 2 attempts",
+		},
+		{
+			name:       "cancellation requested wins over a retry",
+			job:        dto.ExpiredLease{JobID: 1, Attempt: 1, LeaseOwner: "worker-a", CancelRequested: true},
+			wantTo:     jobstate.Cancelled,
+			wantReason: "lease held by worker-a expired while cancelling",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to, reason, delay := reapOutcome(tt.job, retryFirstAttempt)
+			if to != tt.wantTo || reason != tt.wantReason || delay != tt.wantDelay {
+				t.Errorf("reapOutcome(%+v) = %s, %q, %v, want %s, %q, %v", tt.job, to, reason, delay, tt.wantTo, tt.wantReason, tt.wantDelay)
+			}
+		})
+	}
+}
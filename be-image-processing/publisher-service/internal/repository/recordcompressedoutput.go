@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"fmt"
+	"shared/jobstate"
+)
+
+func (r repository) RecordCompressedOutput(id int64, actor string, compressedFileName string, compressedSize int64) error {
+	_, err := jobstate.Transition(r.db, id, jobstate.Change{
+		To:     jobstate.Completed,
+		Actor:  actor,
+		Reason: "recorded existing output " + compressedFileName,
+		Fields: []jobstate.Field{
+			jobstate.Set("error_message", nil),
+			jobstate.Set("compressed_file_name", compressedFileName),
+			jobstate.Set("compressed_size", compressedSize),
+			jobstate.SetExpr("completed_at", "NOW()"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error recording compressed output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"shared/imaging"
+	"shared/jobstate"
+	"time"
+)
+
+var (
+	// ErrJobNotCompleted is returned when a job that has not completed is reprocessed
+	ErrJobNotCompleted = errors.New("only completed jobs can be reprocessed")
+	// ErrRevisionPending is returned when the job's previous reprocess has not finished
+	ErrRevisionPending = errors.New("a reprocess of the job is already pending")
+)
+
+// ReprocessJob queues a new output revision of a completed job produced with
+// opts, and writes its outbox message in one transaction, in the next pacing
+// slot when pace is set. The job stays completed and keeps serving its current
+// output; the worker only replaces it once the revision is produced. It
+// returns the pending revision.
+func (r repository) ReprocessJob(id int64, opts imaging.Options, pace time.Duration, actor, reason string) (int, error) {
+	processingOptions, err := json.Marshal(opts)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding processing options: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var pendingRevision sql.NullInt64
+	err = tx.QueryRow(`SELECT status, pending_revision FROM image_jobs WHERE id = $1 FOR UPDATE`, id).Scan(&status, &pendingRevision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("error reprocessing job %d: %w", id, jobstate.ErrJobNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching job: %w", err)
+	}
+	if status != string(jobstate.Completed) {
+		return 0, fmt.Errorf("job is %s; %w", status, ErrJobNotCompleted)
+	}
+	if pendingRevision.Valid {
+		return 0, fmt.Errorf("revision %d: %w", pendingRevision.Int64, ErrRevisionPending)
+	}
+
+	query := `
+		WITH queued AS (
+			UPDATE image_jobs
+			SET pending_revision = revision + 1, pending_processing_options = $2,
+			    revision_error = NULL, updated_at = NOW()
+			WHERE id = $1
+			RETURNING pending_revision
+		), audited AS (
+			INSERT INTO image_job_events (job_id, from_status, to_status, actor, reason)
+			SELECT $1, 'completed', 'completed', $3, $4 || ' for revision ' || pending_revision FROM queued
+		)
+		SELECT pending_revision FROM queued
+	`
+
+	var revision int
+	if err = tx.QueryRow(query, id, string(processingOptions), actor, reason).Scan(&revision); err != nil {
+		return 0, fmt.Errorf("error queueing revision: %w", err)
+	}
+
+	if err = insertPacedOutbox(tx, id, 1, pace); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing reprocess: %w", err)
+	}
+
+	return revision, nil
+}
+
+// GetSupersededOutputs returns completed jobs that still remember the output
+// of a revision they replaced. An output that was replaced by a file of the
+// same name is never returned, since removing it would remove the current one.
+func (r repository) GetSupersededOutputs(limit int) ([]dto.ImageJob, error) {
+	query := `
+		SELECT ` + imageJobColumns + `
+		FROM image_jobs
+		WHERE status = 'completed'
+		  AND previous_compressed_file_name IS NOT NULL
+		  AND previous_compressed_file_name <> compressed_file_name
+		ORDER BY id
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying superseded outputs: %w", err)
+	}
+
+	return scanImageJobs(rows)
+}
+
+// ClearPreviousOutput forgets the previous output once its files are removed,
+// unless a newer reprocess has replaced it in the meantime
+func (r repository) ClearPreviousOutput(id int64, previousCompressedFileName string) error {
+	query := `
+		UPDATE image_jobs
+		SET previous_compressed_file_name = NULL
+		WHERE id = $1 AND previous_compressed_file_name = $2
+	`
+
+	_, err := r.db.Exec(query, id, previousCompressedFileName)
+	if err != nil {
+		return fmt.Errorf("error clearing previous output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"publisher-service/pkg/dto"
+	"shared/imaging"
+)
+
+const imageJobColumns = `
+	id, filename, original_size, compressed_size, compressed_file_name,
+	status, error_message, created_at, updated_at,
+	completed_at, original_purged_at, compressed_purged_at,
+	attempt, next_retry_at, cancel_requested_at, batch_id,
+	revision, processing_options, previous_compressed_file_name, priority,
+	process_after, pending_revision, revision_error
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanImageJob(row rowScanner) (dto.ImageJob, error) {
+	var job dto.ImageJob
+	var processingOptions []byte
+	err := row.Scan(
+		&job.ID, &job.Filename, &job.OriginalSize, &job.CompressedSize,
+		&job.CompressedFileName, &job.Status, &job.ErrorMessage,
+		&job.CreatedAt, &job.UpdatedAt,
+		&job.CompletedAt, &job.OriginalPurgedAt, &job.CompressedPurgedAt,
+		&job.Attempt, &job.NextRetryAt, &job.CancelRequestedAt, &job.BatchID,
+		&job.Revision, &processingOptions, &job.PreviousCompressedFileName, &job.Priority,
+		&job.ProcessAfter, &job.PendingRevision, &job.RevisionError,
+	)
+	if err != nil {
+		return job, err
+	}
+
+	if len(processingOptions) > 0 {
+		job.ProcessingOptions = &imaging.Options{}
+		if err := json.Unmarshal(processingOptions, job.ProcessingOptions); err != nil {
+			return job, fmt.Errorf("error decoding processing options of job %d: %w", job.ID, err)
+		}
+	}
+	job.OriginalExpired = job.OriginalPurgedAt != nil
+	job.CompressedExpired = job.CompressedPurgedAt != nil
+	return job, nil
+}
+
+func scanImageJobs(rows *sql.Rows) ([]dto.ImageJob, error) {
+	defer rows.Close()
+
+	var jobs []dto.ImageJob
+	for rows.Next() {
+		job, err := scanImageJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning image job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image job rows: %w", err)
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"time"
+)
+
+const logTagBulkRetry = "[BulkRetry]"
+
+// Outcomes reported per job by a bulk retry
+const (
+	outcomeRequeued     = "requeued"
+	outcomeWouldRequeue = "would_requeue"
+	outcomeSkipped      = "skipped"
+)
+
+// requeueableStatuses are the statuses a bulk retry requeues from. Scheduled
+// jobs are enqueued without waiting for their process_after. Pending and
+// retrying jobs already have a message on its way, and a second one under a
+// new message ID would process them twice.
+var requeueableStatuses = []jobstate.Status{jobstate.Failed, jobstate.Cancelled, jobstate.Scheduled}
+
+// RetryJobs requeues the jobs matching the filter and reports the outcome for
+// each of them. Their outbox messages take pacing slots at the configured
+// rate, shared with every other bulk request, so the relay re-enqueues them
+// gradually even after the request returns. Jobs in other statuses are
+// skipped.
+func (s *service) RetryJobs(bulkRetryRequest dto.BulkRetryRequest) (bulkJobResponse dto.BulkJobResponse, err error) {
+	bulkJobResponse = dto.BulkJobResponse{DryRun: bulkRetryRequest.DryRun, Results: []dto.BulkJobResult{}}
+
+	jobs, err := s.findJobs(&bulkRetryRequest.JobFilter)
+	if err != nil {
+		return bulkJobResponse, err
+	}
+	bulkJobResponse.Matched = len(jobs)
+
+	interval := time.Duration(float64(time.Second) / s.conf.bulkRetry.Rate)
+
+	for _, job := range jobs {
+		result := dto.BulkJobResult{ID: job.ID, Outcome: outcomeRequeued}
+
+		if !canRequeue(jobstate.Status(job.Status)) {
+			result.Outcome = outcomeSkipped
+			result.Error = fmt.Sprintf("job is %s", job.Status)
+			bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+			continue
+		}
+
+		if bulkRetryRequest.DryRun {
+			result.Outcome = outcomeWouldRequeue
+			bulkJobResponse.Count++
+			bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+			continue
+		}
+
+		err := s.repository.RequeueJob(job.ID, requeueableStatuses, interval, actorAPI, "bulk retry requested")
+
+		var illegal *jobstate.IllegalTransitionError
+		switch {
+		case err == nil:
+			bulkJobResponse.Count++
+		case errors.As(err, &illegal):
+			// A worker picked the job up since it was selected
+			result.Outcome = outcomeSkipped
+			result.Error = fmt.Sprintf("job is %s", illegal.From)
+		case errors.Is(err, jobstate.ErrJobNotFound):
+			result.Outcome = outcomeNotFound
+		default:
+			slog.Error(fmt.Sprintf("%s requeueing job %d: %v", logTagBulkRetry, job.ID, err))
+			result.Outcome = outcomeError
+			result.Error = err.Error()
+		}
+		bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+	}
+
+	if !bulkRetryRequest.DryRun && bulkJobResponse.Count > 0 {
+		slog.Info(fmt.Sprintf("%s requeued %d of %d matched jobs at %g per second", logTagBulkRetry,
+			bulkJobResponse.Count, bulkJobResponse.Matched, s.conf.bulkRetry.Rate))
+	}
+
+	return bulkJobResponse, nil
+}
+
+func canRequeue(status jobstate.Status) bool {
+	for _, requeueable := range requeueableStatuses {
+		if status == requeueable {
+			return true
+		}
+	}
+	return false
+}
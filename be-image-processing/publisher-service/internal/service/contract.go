@@ -3,41 +3,90 @@ package service
 import (
 	"github.com/gin-gonic/gin"
 	"mime/multipart"
+	"os"
 	"publisher-service/internal/config"
 	"publisher-service/internal/repository"
+	"publisher-service/internal/util/diskcache"
 	"publisher-service/pkg/dto"
+	"shared/messaging"
+	"time"
 )
 
 type Service interface {
 	Ping() (pingResponse dto.PublicPingResponse)
-	HandleUpload(g *gin.Context, files []*multipart.FileHeader) (imageResponse dto.ImageResponse, err error)
-	GetJobs() (imageJobsResponse []dto.ImageJob, err error)
+	Health() (healthResponse dto.HealthResponse, healthy bool)
+	HandleUpload(g *gin.Context, files []*multipart.FileHeader, priority messaging.Priority, processAfter *time.Time) (imageResponse dto.ImageResponse, err error)
+	GetJobs(priority string) (imageJobsResponse []dto.ImageJob, err error)
 	GetJob(id int64) (imageJobResponse dto.ImageJob, err error)
-	GetJobsByStatus(status string) (imageJobsResponse []dto.ImageJob, err error)
+	GetJobsByStatus(status, priority string) (imageJobsResponse []dto.ImageJob, err error)
 	RetryJob(id int64) (err error)
-	ServeImageUploaded(filename string) (imagePath string, isExist bool, err error)
-	ServeImageCompressed(filename string) (imagePath string, isExist bool, err error)
+	RetryJobs(bulkRetryRequest dto.BulkRetryRequest) (bulkJobResponse dto.BulkJobResponse, err error)
+	CancelJob(id int64) (cancelJobResponse dto.CancelJobResponse, err error)
+	DeleteJob(id int64) (err error)
+	DeleteJobs(filter dto.JobFilter) (bulkJobResponse dto.BulkJobResponse, err error)
+	ReprocessJob(id int64, reprocessRequest dto.ReprocessRequest) (reprocessJobResponse dto.ReprocessJobResponse, err error)
+	ReprocessJobs(bulkReprocessRequest dto.BulkReprocessRequest) (bulkJobResponse dto.BulkJobResponse, err error)
+	GetJobAttempts(id int64) (jobAttemptsResponse []dto.JobAttempt, err error)
+	GetJobEvents(id int64) (jobEventsResponse []dto.JobEvent, err error)
+	ServeImageUploaded(filename string) (imagePath string, isExist bool, isExpired bool, err error)
+	ServeImageCompressed(filename string, accept string) (imagePath string, isExist bool, isExpired bool, err error)
 	CompressedUpload(g *gin.Context, file *multipart.FileHeader) (compressedImageResponse dto.CompressedImageResponse, err error)
+	PurgeExpiredFiles() (retentionSweepResponse dto.RetentionSweepResponse, err error)
+	ReconcileStorage(dryRun bool) (reconcileResponse dto.ReconcileResponse, err error)
+	RenderImage(jobID int64, renderOptions dto.RenderOptions) (rendered *os.File, err error)
+	RelayOutbox() (sent int, err error)
+	ReapExpiredLeases() (reapResponse dto.ReapResponse, err error)
+	EnqueueDueJobs() (scheduleResponse dto.ScheduleResponse, err error)
+	ClaimIdempotencyKey(key, requestHash string) (claimToken string, replay *dto.IdempotentResponse, err error)
+	CompleteIdempotencyKey(key, claimToken string, response dto.IdempotentResponse) (err error)
+	ReleaseIdempotencyKey(key, claimToken string) (err error)
+	PurgeExpiredIdempotencyKeys() (purged int64, err error)
+	GetStats() (statsResponse dto.StatsResponse)
+	ListDeadLetters(limit int) (deadLetterListResponse dto.DeadLetterListResponse, err error)
+	GetDeadLetter(messageID string) (deadLetterMessage dto.DeadLetterMessage, err error)
+	ReplayDeadLetters(selection dto.DeadLetterSelection) (deadLetterActionResponse dto.DeadLetterActionResponse, err error)
+	PurgeDeadLetters(selection dto.DeadLetterSelection) (deadLetterActionResponse dto.DeadLetterActionResponse, err error)
 }
 
 type service struct {
-	conf       *serviceConfig
-	repository repository.Repository
-	rabbitmq   *config.RabbitMQ
+	conf        *serviceConfig
+	repository  repository.Repository
+	rabbitmq    *config.RabbitMQ
+	renderCache *diskcache.Cache
 }
 
 type serviceConfig struct {
+	retention   config.RetentionConfig
+	reconcile   config.ReconcileConfig
+	render      config.RenderConfig
+	outbox      config.OutboxConfig
+	reaper      config.ReaperConfig
+	bulkRetry   config.BulkRetryConfig
+	scheduler   config.SchedulerConfig
+	idempotency config.IdempotencyConfig
 }
 
 type NewServiceParams struct {
-	Repository repository.Repository
-	RabbitMQ   *config.RabbitMQ
+	Repository  repository.Repository
+	RabbitMQ    *config.RabbitMQ
+	RenderCache *diskcache.Cache
+	Conf        *config.Config
 }
 
 func NewService(params *NewServiceParams) Service {
 	return &service{
-		conf:       &serviceConfig{},
-		repository: params.Repository,
-		rabbitmq:   params.RabbitMQ,
+		conf: &serviceConfig{
+			retention:   params.Conf.RetentionConfig,
+			reconcile:   params.Conf.ReconcileConfig,
+			render:      params.Conf.RenderConfig,
+			outbox:      params.Conf.OutboxConfig,
+			reaper:      params.Conf.ReaperConfig,
+			bulkRetry:   params.Conf.BulkRetryConfig,
+			scheduler:   params.Conf.SchedulerConfig,
+			idempotency: params.Conf.IdempotencyConfig,
+		},
+		repository:  params.Repository,
+		rabbitmq:    params.RabbitMQ,
+		renderCache: params.RenderCache,
 	}
 }
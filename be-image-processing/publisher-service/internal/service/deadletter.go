@@ -0,0 +1,184 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+)
+
+const (
+	logTagDeadLetter = "[DeadLetter]"
+
+	// maxDeadLetterPeek bounds how many messages one list request holds unacked
+	maxDeadLetterPeek = 500
+	// maxDeadLetterLookup bounds how far into the queue a lookup of one
+	// message searches, since every message scanned is held unacked
+	maxDeadLetterLookup = 500
+	// maxDeadLetterScan bounds how far into the queue a replay or discard searches
+	maxDeadLetterScan = 10000
+)
+
+// ListDeadLetters returns up to limit messages from the head of the DLQ
+func (s *service) ListDeadLetters(limit int) (deadLetterListResponse dto.DeadLetterListResponse, err error) {
+	if limit <= 0 || limit > maxDeadLetterPeek {
+		return deadLetterListResponse, apperror.BadRequest("limit must be between 1 and %d", maxDeadLetterPeek)
+	}
+
+	deadLetters, depth, err := s.rabbitmq.PeekDeadLetters(limit)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s listing dead letters: %v", logTagDeadLetter, err))
+		return deadLetterListResponse, err
+	}
+
+	deadLetterListResponse = dto.DeadLetterListResponse{
+		Depth:    depth,
+		Messages: make([]dto.DeadLetterMessage, 0, len(deadLetters)),
+	}
+	for _, deadLetter := range deadLetters {
+		deadLetterListResponse.Messages = append(deadLetterListResponse.Messages, toDeadLetterMessage(deadLetter))
+	}
+
+	return deadLetterListResponse, nil
+}
+
+// GetDeadLetter looks up one DLQ message by its message ID among the first
+// maxDeadLetterLookup messages of the queue
+func (s *service) GetDeadLetter(messageID string) (deadLetterMessage dto.DeadLetterMessage, err error) {
+	deadLetters, _, err := s.rabbitmq.PeekDeadLetters(maxDeadLetterLookup)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fetching dead letter %s: %v", logTagDeadLetter, messageID, err))
+		return deadLetterMessage, err
+	}
+
+	for _, deadLetter := range deadLetters {
+		if deadLetter.MessageID == messageID {
+			return toDeadLetterMessage(deadLetter), nil
+		}
+	}
+
+	return deadLetterMessage, apperror.NotFound("dead letter %s not found in the first %d messages", messageID, maxDeadLetterLookup)
+}
+
+// ReplayDeadLetters requeues the jobs of the selected DLQ messages through the
+// outbox and removes the messages once the requeue is committed. Messages
+// whose job cannot be requeued stay in the DLQ.
+func (s *service) ReplayDeadLetters(selection dto.DeadLetterSelection) (deadLetterActionResponse dto.DeadLetterActionResponse, err error) {
+	if err = validateDeadLetterSelection(selection); err != nil {
+		return deadLetterActionResponse, err
+	}
+
+	deadLetterActionResponse = dto.DeadLetterActionResponse{
+		NotFound: []string{},
+		Failed:   []dto.DeadLetterIDFailure{},
+	}
+	match, seen := matchDeadLetters(selection)
+
+	replayed, err := s.rabbitmq.TakeDeadLetters(maxDeadLetterScan, match, func(deadLetter config.DeadLetter) error {
+		if deadLetter.JobID == nil {
+			err := fmt.Errorf("message has no job ID")
+			deadLetterActionResponse.Failed = append(deadLetterActionResponse.Failed, dto.DeadLetterIDFailure{MessageID: deadLetter.MessageID, Error: err.Error()})
+			return err
+		}
+
+		if err := s.repository.RequeueJob(*deadLetter.JobID, []jobstate.Status{jobstate.Failed}, 0, actorDLQReplay, "replayed from "+deadLetter.MessageID); err != nil {
+			slog.Error(fmt.Sprintf("%s requeueing job %d: %v", logTagDeadLetter, *deadLetter.JobID, err))
+			deadLetterActionResponse.Failed = append(deadLetterActionResponse.Failed, dto.DeadLetterIDFailure{MessageID: deadLetter.MessageID, Error: err.Error()})
+			return err
+		}
+		return nil
+	})
+	deadLetterActionResponse.Count = replayed
+	deadLetterActionResponse.NotFound = notFoundDeadLetters(selection, seen)
+
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s replaying dead letters: %v", logTagDeadLetter, err))
+		return deadLetterActionResponse, err
+	}
+
+	slog.Info(fmt.Sprintf("%s replayed %d dead letters", logTagDeadLetter, replayed))
+	return deadLetterActionResponse, nil
+}
+
+// PurgeDeadLetters drops the selected DLQ messages, or the whole queue
+func (s *service) PurgeDeadLetters(selection dto.DeadLetterSelection) (deadLetterActionResponse dto.DeadLetterActionResponse, err error) {
+	if err = validateDeadLetterSelection(selection); err != nil {
+		return deadLetterActionResponse, err
+	}
+
+	deadLetterActionResponse = dto.DeadLetterActionResponse{
+		NotFound: []string{},
+		Failed:   []dto.DeadLetterIDFailure{},
+	}
+
+	if selection.All {
+		deadLetterActionResponse.Count, err = s.rabbitmq.PurgeDeadLetters()
+	} else {
+		match, seen := matchDeadLetters(selection)
+		deadLetterActionResponse.Count, err = s.rabbitmq.TakeDeadLetters(maxDeadLetterScan, match, func(config.DeadLetter) error {
+			return nil
+		})
+		deadLetterActionResponse.NotFound = notFoundDeadLetters(selection, seen)
+	}
+
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s purging dead letters: %v", logTagDeadLetter, err))
+		return deadLetterActionResponse, err
+	}
+
+	slog.Info(fmt.Sprintf("%s purged %d dead letters", logTagDeadLetter, deadLetterActionResponse.Count))
+	return deadLetterActionResponse, nil
+}
+
+func validateDeadLetterSelection(selection dto.DeadLetterSelection) error {
+	if selection.All == (len(selection.MessageIDs) > 0) {
+		return apperror.BadRequest("either message_ids or all must be set")
+	}
+	return nil
+}
+
+// matchDeadLetters returns a matcher for the selection and the set of message
+// IDs it matched
+func matchDeadLetters(selection dto.DeadLetterSelection) (func(config.DeadLetter) bool, map[string]bool) {
+	wanted := make(map[string]bool, len(selection.MessageIDs))
+	for _, id := range selection.MessageIDs {
+		wanted[id] = true
+	}
+
+	seen := make(map[string]bool)
+	return func(deadLetter config.DeadLetter) bool {
+		if selection.All || wanted[deadLetter.MessageID] {
+			seen[deadLetter.MessageID] = true
+			return true
+		}
+		return false
+	}, seen
+}
+
+func notFoundDeadLetters(selection dto.DeadLetterSelection, seen map[string]bool) []string {
+	notFound := []string{}
+	for _, id := range selection.MessageIDs {
+		if !seen[id] {
+			notFound = append(notFound, id)
+		}
+	}
+	return notFound
+}
+
+func toDeadLetterMessage(deadLetter config.DeadLetter) dto.DeadLetterMessage {
+	return dto.DeadLetterMessage{
+		MessageID:   deadLetter.MessageID,
+		JobID:       deadLetter.JobID,
+		Reason:      deadLetter.Reason,
+		Stage:       deadLetter.Stage,
+		Retryable:   deadLetter.Retryable,
+		Attempt:     deadLetter.Attempt,
+		FailedAt:    deadLetter.FailedAt,
+		FailedBy:    deadLetter.FailedBy,
+		Redelivered: deadLetter.Redelivered,
+		ContentType: deadLetter.ContentType,
+		Body:        string(deadLetter.Body),
+	}
+}
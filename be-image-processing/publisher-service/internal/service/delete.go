@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/config"
+	"publisher-service/internal/repository"
+	"publisher-service/internal/util/ginhttputil"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"shared/messaging"
+)
+
+const (
+	logTagDelete = "[Delete]"
+
+	defaultBulkLimit = 100
+	maxBulkLimit     = 1000
+)
+
+// Outcomes reported per job by bulk operations
+const (
+	outcomeDeleted    = "deleted"
+	outcomeCancelling = "cancelling"
+	outcomeNotFound   = "not_found"
+	outcomeError      = "error"
+)
+
+// DeleteJob deletes a job with its original and its outputs. A job a worker is
+// producing an output for is not deleted; its cancellation is requested and
+// the caller is told to delete it again once it is cancelled.
+func (s *service) DeleteJob(id int64) (err error) {
+	err = s.deleteJob(id)
+	if errors.Is(err, jobstate.ErrJobNotFound) {
+		return apperror.NotFound("job not found")
+	}
+	if errors.Is(err, repository.ErrJobInFlight) {
+		return apperror.Conflict("job is being processed; cancellation was requested, " +
+			"delete it again once it is cancelled")
+	}
+	return err
+}
+
+// DeleteJobs deletes the jobs matching filter like DeleteJob and reports the
+// outcome for each of them
+func (s *service) DeleteJobs(filter dto.JobFilter) (bulkJobResponse dto.BulkJobResponse, err error) {
+	bulkJobResponse = dto.BulkJobResponse{Results: []dto.BulkJobResult{}}
+
+	jobs, err := s.findJobs(&filter)
+	if err != nil {
+		return bulkJobResponse, err
+	}
+	bulkJobResponse.Matched = len(jobs)
+
+	for _, job := range jobs {
+		result := dto.BulkJobResult{ID: job.ID, Outcome: outcomeDeleted}
+
+		err := s.deleteJob(job.ID)
+		switch {
+		case err == nil:
+			bulkJobResponse.Count++
+		case errors.Is(err, jobstate.ErrJobNotFound):
+			result.Outcome = outcomeNotFound
+		case errors.Is(err, repository.ErrJobInFlight):
+			result.Outcome = outcomeCancelling
+		default:
+			result.Outcome = outcomeError
+			result.Error = err.Error()
+		}
+		bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+	}
+
+	return bulkJobResponse, nil
+}
+
+func (s *service) deleteJob(id int64) error {
+	job, err := s.repository.DeleteJob(id)
+	if err != nil {
+		if !errors.Is(err, jobstate.ErrJobNotFound) && !errors.Is(err, repository.ErrJobInFlight) {
+			slog.Error(fmt.Sprintf("%s deleting job %d: %v", logTagDelete, id, err))
+		}
+		return err
+	}
+
+	s.removeJobFiles(job)
+	slog.Info(fmt.Sprintf("%s deleted job %d", logTagDelete, id))
+	return nil
+}
+
+// findJobs validates filter, applies the default limit and returns the jobs it
+// selects. An empty filter is rejected so a bulk operation never applies to
+// every job by accident.
+func (s *service) findJobs(filter *dto.JobFilter) ([]dto.ImageJob, error) {
+	if len(filter.IDs) == 0 && filter.Status == "" && filter.ErrorContains == "" && filter.BatchID == "" &&
+		filter.Priority == "" && filter.CreatedAfter == nil && filter.CreatedBefore == nil {
+		return nil, apperror.BadRequest("filter must select jobs by id, status, error, batch, " +
+			"priority or creation time")
+	}
+	if filter.Priority != "" {
+		if _, err := messaging.ParsePriority(filter.Priority); err != nil {
+			return nil, apperror.BadRequest("%v", err)
+		}
+	}
+	if filter.Status != "" && !jobstate.IsValid(jobstate.Status(filter.Status)) {
+		return nil, apperror.BadRequest("invalid status: %s", filter.Status)
+	}
+	if filter.Limit < 0 || filter.Limit > maxBulkLimit {
+		return nil, apperror.BadRequest("limit must be between 1 and %d", maxBulkLimit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultBulkLimit
+	}
+
+	jobs, err := s.repository.FindJobs(*filter)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error finding jobs: %v", err))
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// removeJobFiles deletes the original, every output the job may have left in
+// storage and its cached renders, and forgets their content hashes. Failures
+// are only logged since the job row is already gone and the reconciler
+// removes what is left as orphans.
+func (s *service) removeJobFiles(job dto.ImageJob) {
+	paths := []string{filepath.Join(config.UploadsDir, job.Filename)}
+
+	// The worker's output may exist even if it was never recorded
+	outputs := []string{compressedFilePrefix + job.Filename}
+	for _, recorded := range []*string{job.CompressedFileName, job.PreviousCompressedFileName} {
+		if recorded != nil && *recorded != outputs[0] {
+			outputs = append(outputs, *recorded)
+		}
+	}
+	for _, output := range outputs {
+		paths = append(paths, filepath.Join(config.CompressedDir, output))
+		for _, variant := range compressedVariantNames(output) {
+			paths = append(paths, filepath.Join(config.CompressedDir, variant))
+		}
+	}
+
+	for _, path := range paths {
+		if err := removeStoredFile(path); err != nil {
+			slog.Error(fmt.Sprintf("%s removing %s of job %d: %v", logTagDelete, path, job.ID, err))
+		}
+	}
+
+	paths = append(paths, s.renderCache.RemovePrefix(renderCachePrefix(job.ID))...)
+	ginhttputil.ForgetFileETags(paths...)
+}
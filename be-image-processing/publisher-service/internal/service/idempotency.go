@@ -0,0 +1,93 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/util/helper"
+	"publisher-service/pkg/dto"
+)
+
+const (
+	logTagIdempotency = "[Idempotency]"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// ClaimIdempotencyKey reserves key for the request identified by requestHash.
+// It returns the stored response when the same request already finished under
+// key. Otherwise the caller claimed key and should handle the request, then
+// complete or release key with the returned claim token. A key in use by
+// another request, or still in flight, is a conflict.
+func (s *service) ClaimIdempotencyKey(key, requestHash string) (claimToken string, replay *dto.IdempotentResponse, err error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return "", nil, apperror.BadRequest("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+
+	// A key that expires or is released between the claim and the lookup can
+	// be claimed again, so try twice before giving up
+	for range 2 {
+		claimToken = helper.GenerateClaimToken()
+		claimed, err := s.repository.ClaimIdempotencyKey(key, requestHash, claimToken, s.conf.idempotency.LockTimeout)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s claiming key %q: %v", logTagIdempotency, key, err))
+			return "", nil, err
+		}
+		if claimed {
+			return claimToken, nil, nil
+		}
+
+		stored, err := s.repository.GetIdempotencyKey(key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s fetching key %q: %v", logTagIdempotency, key, err))
+			return "", nil, err
+		}
+
+		if stored.RequestHash != requestHash {
+			return "", nil, apperror.Conflict("Idempotency-Key %q was already used with a different request", key)
+		}
+		if stored.Response == nil {
+			return "", nil, apperror.Conflict("a request with Idempotency-Key %q is still in progress", key)
+		}
+		return "", stored.Response, nil
+	}
+
+	return "", nil, apperror.Conflict("a request with Idempotency-Key %q is still in progress", key)
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed key
+// under claimToken, to be replayed until the TTL passes
+func (s *service) CompleteIdempotencyKey(key, claimToken string, response dto.IdempotentResponse) (err error) {
+	if err = s.repository.SaveIdempotentResponse(key, claimToken, response, s.conf.idempotency.TTL); err != nil {
+		slog.Error(fmt.Sprintf("%s saving response for key %q: %v", logTagIdempotency, key, err))
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key claimed under claimToken, so a request
+// that failed can be retried under it
+func (s *service) ReleaseIdempotencyKey(key, claimToken string) (err error) {
+	if err = s.repository.DeleteIdempotencyKey(key, claimToken); err != nil {
+		slog.Error(fmt.Sprintf("%s releasing key %q: %v", logTagIdempotency, key, err))
+	}
+	return err
+}
+
+// PurgeExpiredIdempotencyKeys deletes keys whose TTL passed
+func (s *service) PurgeExpiredIdempotencyKeys() (purged int64, err error) {
+	purged, err = s.repository.PurgeExpiredIdempotencyKeys()
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s purging expired keys: %v", logTagIdempotency, err))
+		return 0, err
+	}
+
+	if purged > 0 {
+		slog.Info(fmt.Sprintf("%s purged %d expired keys", logTagIdempotency, purged))
+	}
+	return purged, nil
+}
@@ -10,10 +10,13 @@ import (
 	"path/filepath"
 	"publisher-service/internal/util/helper"
 	"publisher-service/pkg/dto"
+	"shared/messaging"
+	"time"
 )
 
-func (s *service) HandleUpload(g *gin.Context, files []*multipart.FileHeader) (imageResponse dto.ImageResponse, err error) {
+func (s *service) HandleUpload(g *gin.Context, files []*multipart.FileHeader, priority messaging.Priority, processAfter *time.Time) (imageResponse dto.ImageResponse, err error) {
 	var jobIDs []int64
+	batchID := helper.GenerateBatchID()
 	for _, file := range files {
 		if !helper.IsImage(file.Filename) {
 			slog.Warn(fmt.Sprintf("Skipping non-image file: %s", file.Filename))
@@ -40,52 +43,59 @@ func (s *service) HandleUpload(g *gin.Context, files []*multipart.FileHeader) (i
 
 		originalSize := fileInfo.Size()
 
-		// Create job in database
-		jobID, err := s.repository.CreateImageJob(filename, originalSize)
+		// Create job in database; the outbox relay publishes it to the queue
+		jobID, err := s.repository.CreateImageJob(filename, originalSize, batchID, string(priority), processAfter)
 		if err != nil {
 			slog.Error(fmt.Sprintf("Error creating job for %s: %v", filename, err))
 			os.Remove(filepathImage) // Clean up file
 			continue
 		}
 
-		// Publish job to queue
-		err = s.rabbitmq.PublishJob(jobID, filename)
-		if err != nil {
-			slog.Error(fmt.Sprintf("Error publishing job for %s: %v", filename, err))
-			s.repository.UpdateJobStatus(jobID, "failed")
-			continue
-		}
-
-		err = s.repository.UpdateJobStatus(jobID, "processing")
-		if err != nil {
-			slog.Error(fmt.Sprintf("Error updating job status: %v", err))
-			continue
-		}
-
 		jobIDs = append(jobIDs, jobID)
 		slog.Info(fmt.Sprintf("Successfully processed upload: %s, size: %d bytes, job ID: %d", filename, originalSize, jobID))
 	}
-	return dto.ImageResponse{JobIDs: jobIDs}, nil
+	return dto.ImageResponse{JobIDs: jobIDs, BatchID: batchID}, nil
 }
 
-func (s *service) ServeImageUploaded(filename string) (imagePath string, isExist bool, err error) {
+func (s *service) ServeImageUploaded(filename string) (imagePath string, isExist bool, isExpired bool, err error) {
 	imagePath = filepath.Join("/app/uploads", filename)
 
 	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
 		isExist = os.IsNotExist(err)
+
+		// A missing file that retention purged is reported as expired
+		job, jobErr := s.repository.GetImageJobByFilename(filename)
+		if jobErr == nil && job.OriginalPurgedAt != nil {
+			return imagePath, isExist, true, nil
+		}
+
 		slog.Error("Image not found")
-		return imagePath, isExist, err
+		return imagePath, isExist, false, err
 	}
 	return
 }
 
-func (s *service) ServeImageCompressed(filename string) (imagePath string, isExist bool, err error) {
+func (s *service) ServeImageCompressed(filename string, accept string) (imagePath string, isExist bool, isExpired bool, err error) {
 	imagePath = filepath.Join("/app/compressed", filename)
 
+	// Prefer a pre-generated format the client accepts over the original output
+	if accept != "" {
+		if variantPath := negotiateCompressedVariant("/app/compressed", filename, accept); variantPath != "" {
+			return variantPath, false, false, nil
+		}
+	}
+
 	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
 		isExist = os.IsNotExist(err)
+
+		// A missing file that retention purged is reported as expired
+		job, jobErr := s.repository.GetImageJobByCompressedFileName(filename)
+		if jobErr == nil && job.CompressedPurgedAt != nil {
+			return imagePath, isExist, true, nil
+		}
+
 		slog.Error("Image not found")
-		return imagePath, isExist, err
+		return imagePath, isExist, false, err
 	}
 	return
 }
@@ -1,14 +1,24 @@
 package service
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"publisher-service/internal/apperror"
 	"publisher-service/pkg/dto"
+	"shared/jobstate"
 )
 
-func (s *service) GetJobs() (imageJobsResponse []dto.ImageJob, err error) {
-	jobs, err := s.repository.GetImageJobs()
+// Actors recorded in the job event audit trail for changes made here
+const (
+	actorAPI        = "publisher:api"
+	actorReconciler = "publisher:reconciler"
+	actorDLQReplay  = "publisher:dlq-replay"
+)
+
+func (s *service) GetJobs(priority string) (imageJobsResponse []dto.ImageJob, err error) {
+	jobs, err := s.repository.GetImageJobs(priority)
 	if err != nil {
 		slog.Error(fmt.Sprintf("Error fetching jobs: %v", err))
 		return nil, err
@@ -26,8 +36,8 @@ func (s *service) GetJob(id int64) (imageJobResponse dto.ImageJob, err error) {
 	return
 }
 
-func (s *service) GetJobsByStatus(status string) (imageJobsResponse []dto.ImageJob, err error) {
-	imageJobsResponse, err = s.repository.GetImageJobsByStatus(status)
+func (s *service) GetJobsByStatus(status, priority string) (imageJobsResponse []dto.ImageJob, err error) {
+	imageJobsResponse, err = s.repository.GetImageJobsByStatus(status, priority)
 
 	if err != nil {
 		slog.Error(fmt.Sprintf("Error fetching job: %v", err))
@@ -37,34 +47,78 @@ func (s *service) GetJobsByStatus(status string) (imageJobsResponse []dto.ImageJ
 }
 
 func (s *service) RetryJob(id int64) (err error) {
-	job, err := s.repository.GetImageJob(id)
+	// The outbox relay publishes the job once the requeue is committed
+	err = s.repository.RequeueJob(id, []jobstate.Status{jobstate.Failed}, 0, actorAPI, "retry requested")
+	if errors.Is(err, jobstate.ErrJobNotFound) {
+		return apperror.NotFound("job not found")
+	}
+	if errors.Is(err, jobstate.ErrIllegalTransition) {
+		return apperror.Conflict("only failed jobs can be retried")
+	}
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error fetching job: %v", err))
-		return
+		slog.Error(fmt.Sprintf("Error requeueing job: %v", err))
+		return err
 	}
 
-	if job.Status != "failed" {
-		slog.Error("Only failed jobs can be retried")
-		return errors.New("only failed jobs can be retried")
+	return
+}
+
+// CancelJob cancels a waiting job right away. A processing job is reported as
+// cancelling until its worker notices the request, aborts and removes the
+// partial output.
+func (s *service) CancelJob(id int64) (cancelJobResponse dto.CancelJobResponse, err error) {
+	status, err := s.repository.CancelJob(id, actorAPI, "cancel requested")
+	if errors.Is(err, jobstate.ErrJobNotFound) {
+		return cancelJobResponse, apperror.NotFound("job not found")
+	}
+	var illegal *jobstate.IllegalTransitionError
+	if errors.As(err, &illegal) {
+		return cancelJobResponse, apperror.Conflict("job is already %s", illegal.From)
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error cancelling job: %v", err))
+		return cancelJobResponse, err
 	}
 
-	err = s.repository.UpdateJobStatus(id, "pending")
+	cancelJobResponse = dto.CancelJobResponse{ID: id, Status: string(status)}
+	if status == jobstate.Processing {
+		cancelJobResponse.Status = "cancelling"
+	}
+	return cancelJobResponse, nil
+}
+
+func (s *service) GetJobAttempts(id int64) (jobAttemptsResponse []dto.JobAttempt, err error) {
+	_, err = s.repository.GetImageJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound("job not found")
+	}
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error updating job status: %v", err))
-		return err
+		slog.Error(fmt.Sprintf("Error fetching job: %v", err))
+		return nil, err
 	}
 
-	err = s.rabbitmq.PublishJob(id, job.Filename)
+	jobAttemptsResponse, err = s.repository.GetJobAttempts(id)
 	if err != nil {
-		// If publishing fails, revert status to failed
-		err = s.repository.UpdateJobStatus(id, "failed")
-		if err != nil {
-			slog.Error(fmt.Sprintf("Error updating job status: %v", err))
-			return err
-		}
-		slog.Error(fmt.Sprintf("Error publishing job to queue: %v", err))
-		return err
+		slog.Error(fmt.Sprintf("Error fetching job attempts: %v", err))
+		return nil, err
 	}
+	return jobAttemptsResponse, nil
+}
 
-	return
+func (s *service) GetJobEvents(id int64) (jobEventsResponse []dto.JobEvent, err error) {
+	_, err = s.repository.GetImageJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound("job not found")
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error fetching job: %v", err))
+		return nil, err
+	}
+
+	jobEventsResponse, err = s.repository.GetJobEvents(id)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error fetching job events: %v", err))
+		return nil, err
+	}
+	return jobEventsResponse, nil
 }
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"shared/messaging"
+)
+
+const logTagOutbox = "[Outbox]"
+
+// RelayOutbox publishes due outbox messages to RabbitMQ. A message is only
+// marked sent after the broker accepted it, so every job is enqueued at least
+// once even if the process dies mid-relay. The message ID is derived from the
+// outbox row, so a message published again after a lost confirm carries the
+// same ID and the subscriber processes it only once.
+func (s *service) RelayOutbox() (sent int, err error) {
+	sent, err = s.repository.RelayOutbox(s.conf.outbox.BatchSize, s.conf.outbox.ClaimTimeout, func(message dto.OutboxMessage) (bool, error) {
+		messageID := fmt.Sprintf("job-%d-%d", message.JobID, message.ID)
+		if err := s.rabbitmq.PublishJob(messageID, message.JobID, message.Filename, message.JobAttempt, messaging.Priority(message.Priority)); err != nil {
+			// A nack or an unroutable return will not fix itself by retrying
+			permanent := errors.Is(err, config.ErrPublishNacked) || errors.Is(err, config.ErrPublishReturned) ||
+				message.Attempts+1 >= s.conf.outbox.MaxAttempts
+			slog.Error(fmt.Sprintf("%s publishing job %d (attempt %d, giving up: %t): %v", logTagOutbox, message.JobID, message.Attempts+1, permanent, err))
+			return permanent, err
+		}
+		return false, nil
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s relaying outbox: %v", logTagOutbox, err))
+		return sent, err
+	}
+
+	if sent > 0 {
+		slog.Info(fmt.Sprintf("%s relayed %d job messages", logTagOutbox, sent))
+	}
+	return sent, nil
+}
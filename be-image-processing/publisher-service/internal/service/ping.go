@@ -5,9 +5,40 @@ import (
 	"time"
 )
 
+const (
+	healthUp   = "up"
+	healthDown = "down"
+)
+
 func (s *service) Ping() (pingResponse dto.PublicPingResponse) {
 	return dto.PublicPingResponse{
 		Message:   "pong",
 		Timestamp: time.Now().Unix(),
 	}
 }
+
+// Health reports whether the database and RabbitMQ are reachable. RabbitMQ
+// shows as down while the connection supervisor is reconnecting.
+func (s *service) Health() (healthResponse dto.HealthResponse, healthy bool) {
+	healthResponse = dto.HealthResponse{
+		Status:   healthUp,
+		Database: healthUp,
+		RabbitMQ: healthUp,
+	}
+	healthy = true
+
+	if err := s.repository.Ping(); err != nil {
+		healthResponse.Database = healthDown
+		healthy = false
+	}
+
+	if !s.rabbitmq.IsConnected() {
+		healthResponse.RabbitMQ = healthDown
+		healthy = false
+	}
+
+	if !healthy {
+		healthResponse.Status = healthDown
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"publisher-service/pkg/dto"
+	"time"
+)
+
+const logTagReaper = "[Reaper]"
+
+// ReapExpiredLeases takes over jobs whose worker stopped heartbeating. A job
+// is retried after the delay for the attempt that expired, like any other
+// retryable failure, and failed once the retry delays run out.
+func (s *service) ReapExpiredLeases() (reapResponse dto.ReapResponse, err error) {
+	reapResponse, err = s.repository.ReapExpiredLeases(s.conf.reaper.BatchSize, s.conf.reaper.StaleAfter, retryExpiredLease(s.conf.reaper.RetryDelays))
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s reaping expired leases: %v", logTagReaper, err))
+		return reapResponse, err
+	}
+
+	if len(reapResponse.Requeued) > 0 || len(reapResponse.Failed) > 0 || len(reapResponse.Cancelled) > 0 {
+		slog.Warn(fmt.Sprintf("%s requeued %v, failed %v, cancelled %v", logTagReaper, reapResponse.Requeued, reapResponse.Failed, reapResponse.Cancelled))
+	}
+	return reapResponse, nil
+}
+
+// retryExpiredLease grants an expired attempt the retry delay configured for
+// it. Attempts past the last delay are not retried.
+func retryExpiredLease(delays []time.Duration) func(job dto.ExpiredLease) (bool, time.Duration) {
+	return func(job dto.ExpiredLease) (bool, time.Duration) {
+		if job.Attempt < 1 || job.Attempt > len(delays) {
+			return false, 0
+		}
+		return true, delays[job.Attempt-1]
+	}
+}
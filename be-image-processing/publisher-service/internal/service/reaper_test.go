@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"publisher-service/pkg/dto"
+)
+
+func TestRetryExpiredLease(t *testing.T) {
+	delays := []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+	tests := []struct {
+		name      string
+		delays    []time.Duration
+		attempt   int
+		wantRetry bool
+		wantDelay time.Duration
+	}{
+		{"never attempted", delays, 0, false, 0},
+		{"first attempt", delays, 1, true, 10 * time.Second},
+		{"last configured attempt", delays, 3, true, 5 * time.Minute},
+		{"delays exhausted", delays, 4, false, 0},
+		{"no delays configured", nil, 1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, delay := retryExpiredLease(tt.delays)(dto.ExpiredLease{JobID: 1, Attempt: tt.attempt})
+			if retry != tt.wantRetry || delay != tt.wantDelay {
+				t.Errorf("retryExpiredLease(attempt %d) = %t, %v, want %t, %v", tt.attempt, retry, delay, tt.wantRetry, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"shared/jobstate"
+	"slices"
+	"time"
+)
+
+const (
+	logTagReconcile      = "[Reconcile]"
+	compressedFilePrefix = "compressed_"
+)
+
+// ReconcileStorage compares the files in uploads/ and compressed/ with the job
+// rows and reports files without jobs, jobs whose files are missing and
+// outputs the worker saved but never recorded. Outputs of failed and
+// cancelled jobs are treated as orphans. Unless dryRun is set, it also
+// fixes what it finds. Files younger than the grace period are left alone so
+// in-flight uploads are not mistaken for orphans. Jobs are walked a page at a
+// time and directory entries are looked up in batches, so memory does not
+// grow with the number of jobs or files.
+func (s *service) ReconcileStorage(dryRun bool) (reconcileResponse dto.ReconcileResponse, err error) {
+	reconcileResponse = dto.ReconcileResponse{
+		DryRun:            dryRun,
+		OrphanUploads:     []string{},
+		OrphanOutputs:     []string{},
+		UnrecordedOutputs: []dto.ReconcileOutput{},
+		MissingOriginals:  []int64{},
+		MissingOutputs:    []int64{},
+	}
+
+	cutoff := time.Now().Add(-s.conf.reconcile.GracePeriod)
+	batchSize := s.conf.reconcile.BatchSize
+
+	var afterID int64
+	for {
+		jobs, err := s.repository.GetImageJobsAfter(afterID, batchSize)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s fetching jobs: %v", logTagReconcile, err))
+			return reconcileResponse, err
+		}
+
+		for _, job := range jobs {
+			s.reconcileJob(&reconcileResponse, job, cutoff, dryRun)
+		}
+
+		if len(jobs) < batchSize {
+			break
+		}
+		afterID = jobs[len(jobs)-1].ID
+	}
+
+	orphanUploads, err := findOrphanFiles(config.UploadsDir, cutoff, batchSize, s.repository.FindKnownUploads)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s listing uploads: %v", logTagReconcile, err))
+		return reconcileResponse, err
+	}
+	for _, name := range orphanUploads {
+		reconcileResponse.OrphanUploads = append(reconcileResponse.OrphanUploads, name)
+		if !dryRun {
+			s.fixFile(&reconcileResponse, filepath.Join(config.UploadsDir, name))
+		}
+	}
+
+	orphanOutputs, err := findOrphanFiles(config.CompressedDir, cutoff, batchSize, s.findKnownOutputs)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s listing outputs: %v", logTagReconcile, err))
+		return reconcileResponse, err
+	}
+	for _, name := range orphanOutputs {
+		reconcileResponse.OrphanOutputs = append(reconcileResponse.OrphanOutputs, name)
+		if !dryRun {
+			s.fixFile(&reconcileResponse, filepath.Join(config.CompressedDir, name))
+		}
+	}
+
+	slog.Info(fmt.Sprintf("%s dry run: %t, orphan uploads: %d, orphan outputs: %d, unrecorded outputs: %d, missing originals: %d, missing outputs: %d, fixed: %d",
+		logTagReconcile, dryRun, len(reconcileResponse.OrphanUploads), len(reconcileResponse.OrphanOutputs),
+		len(reconcileResponse.UnrecordedOutputs), len(reconcileResponse.MissingOriginals),
+		len(reconcileResponse.MissingOutputs), reconcileResponse.Fixed))
+
+	return reconcileResponse, nil
+}
+
+// reconcileJob checks the files of one job against storage
+func (s *service) reconcileJob(reconcileResponse *dto.ReconcileResponse, job dto.ImageJob, cutoff time.Time, dryRun bool) {
+	// Jobs whose original disappeared without retention purging it
+	if job.OriginalPurgedAt == nil {
+		if _, ok := statStoredFile(filepath.Join(config.UploadsDir, job.Filename)); !ok {
+			reconcileResponse.MissingOriginals = append(reconcileResponse.MissingOriginals, job.ID)
+			// Finished jobs only need the original recorded as gone
+			if !dryRun && (job.Status == string(jobstate.Completed) || job.Status == string(jobstate.Failed) || job.Status == string(jobstate.Cancelled)) {
+				s.fixJob(reconcileResponse, s.repository.MarkOriginalPurged(job.ID), job.ID)
+			} else if !dryRun {
+				s.fixJob(reconcileResponse, s.repository.FailJob(job.ID, actorReconciler, "original file missing"), job.ID)
+			}
+		}
+	}
+
+	// Completed jobs whose recorded output is gone are recorded as purged, so
+	// the output is reported gone and can be regenerated by a reprocess
+	if job.Status == string(jobstate.Completed) && job.CompressedPurgedAt == nil && job.CompressedFileName != nil {
+		if _, ok := statStoredFile(filepath.Join(config.CompressedDir, *job.CompressedFileName)); !ok {
+			reconcileResponse.MissingOutputs = append(reconcileResponse.MissingOutputs, job.ID)
+			if !dryRun {
+				s.fixJob(reconcileResponse, s.repository.MarkCompressedPurged(job.ID), job.ID)
+			}
+		}
+	}
+
+	// Outputs uploaded by the worker that never made it into the row. Only a
+	// job still being processed is completed with one; a failed or cancelled
+	// job's output is an orphan.
+	if isProcessingStatus(job.Status) && job.CompressedFileName == nil {
+		outputName := compressedFilePrefix + job.Filename
+		if info, ok := statStoredFile(filepath.Join(config.CompressedDir, outputName)); ok && info.ModTime().Before(cutoff) {
+			reconcileResponse.UnrecordedOutputs = append(reconcileResponse.UnrecordedOutputs, dto.ReconcileOutput{
+				JobID:              job.ID,
+				CompressedFileName: outputName,
+			})
+			if !dryRun {
+				s.fixJob(reconcileResponse, s.repository.RecordCompressedOutput(job.ID, actorReconciler, outputName, info.Size()), job.ID)
+			}
+		}
+	}
+}
+
+func (s *service) fixJob(reconcileResponse *dto.ReconcileResponse, err error, id int64) {
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fixing job %d: %v", logTagReconcile, id, err))
+		return
+	}
+	reconcileResponse.Fixed++
+}
+
+func (s *service) fixFile(reconcileResponse *dto.ReconcileResponse, path string) {
+	if err := removeStoredFile(path); err != nil {
+		slog.Error(fmt.Sprintf("%s removing %s: %v", logTagReconcile, path, err))
+		return
+	}
+	reconcileResponse.Fixed++
+}
+
+// statStoredFile returns the file at path if it is a regular file
+func statStoredFile(path string) (os.FileInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	return info, true
+}
+
+// findOrphanFiles returns the regular files directly inside dir that are older
+// than cutoff and that known does not recognise. The directory is read and
+// looked up batchSize entries at a time.
+func findOrphanFiles(dir string, cutoff time.Time, batchSize int, known func(names []string) (map[string]bool, error)) ([]string, error) {
+	d, err := os.Open(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	var orphans []string
+	for {
+		entries, readErr := d.ReadDir(batchSize)
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, readErr
+		}
+
+		var candidates []string
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			candidates = append(candidates, entry.Name())
+		}
+
+		if len(candidates) > 0 {
+			knownNames, err := known(candidates)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range candidates {
+				if !knownNames[name] {
+					orphans = append(orphans, name)
+				}
+			}
+		}
+
+		if readErr != nil {
+			return orphans, nil
+		}
+	}
+}
+
+// findKnownOutputs returns which of names are outputs of a job. A variant is
+// known when an output it may have been generated from is.
+func (s *service) findKnownOutputs(names []string) (map[string]bool, error) {
+	lookup := slices.Clone(names)
+	for _, name := range names {
+		lookup = append(lookup, variantSourceNames(name)...)
+	}
+
+	known, err := s.repository.FindKnownOutputs(lookup, compressedFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		for _, source := range variantSourceNames(name) {
+			if known[source] {
+				known[name] = true
+			}
+		}
+	}
+	return known, nil
+}
+
+// isProcessingStatus reports whether a job in status may still produce an output
+func isProcessingStatus(status string) bool {
+	switch jobstate.Status(status) {
+	case jobstate.Pending, jobstate.Processing, jobstate.Retrying:
+		return true
+	}
+	return false
+}
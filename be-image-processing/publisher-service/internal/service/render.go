@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"shared/imaging"
+	"slices"
+)
+
+const logTagRender = "[Render]"
+
+// RenderImage transforms the stored original of a job and returns the
+// rendered file, reusing a cached render when one exists. The file is open so
+// the cache evicting it cannot pull it from under the response; the caller
+// closes it.
+func (s *service) RenderImage(jobID int64, renderOptions dto.RenderOptions) (rendered *os.File, err error) {
+	opts, err := s.validateRenderOptions(renderOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.repository.GetImageJob(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound("job not found")
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fetching job %d: %v", logTagRender, jobID, err))
+		return nil, err
+	}
+
+	if job.OriginalPurgedAt != nil {
+		return nil, apperror.Gone("image expired")
+	}
+
+	if opts.Format == "" {
+		opts.Format, err = imaging.FormatFromFilename(job.Filename)
+		if err != nil {
+			return nil, apperror.BadRequest("%v", err)
+		}
+	}
+
+	key := renderCacheKey(job, opts)
+	if cached, ok := s.renderCache.Get(key); ok {
+		return cached, nil
+	}
+
+	source, err := os.Open(filepath.Join(config.UploadsDir, job.Filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, apperror.NotFound("image not found")
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s opening original of job %d: %v", logTagRender, jobID, err))
+		return nil, err
+	}
+	defer source.Close()
+
+	rendered, err = s.renderCache.Put(key, func(w io.Writer) error {
+		_, err := imaging.Transform(source, w, opts)
+		return err
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s rendering job %d: %v", logTagRender, jobID, err))
+		return nil, err
+	}
+
+	slog.Info(fmt.Sprintf("%s rendered job %d at %dx%d %s %s q%d", logTagRender, jobID, opts.Width, opts.Height, opts.Fit, opts.Format, opts.Quality))
+	return rendered, nil
+}
+
+// validateRenderOptions checks the request against the configured allowlists
+// and fills in defaults
+func (s *service) validateRenderOptions(renderOptions dto.RenderOptions) (imaging.Options, error) {
+	render := s.conf.render
+
+	size := fmt.Sprintf("%dx%d", renderOptions.Width, renderOptions.Height)
+	if !slices.Contains(render.AllowedSizes, size) {
+		return imaging.Options{}, apperror.BadRequest("size %s is not allowed", size)
+	}
+
+	fit := imaging.FitContain
+	if renderOptions.Fit != "" {
+		fit = imaging.Fit(renderOptions.Fit)
+		if !imaging.IsValidFit(fit) {
+			return imaging.Options{}, apperror.BadRequest("invalid fit %s. Must be one of: contain, cover, fill", renderOptions.Fit)
+		}
+	}
+
+	var format string
+	if renderOptions.Format != "" {
+		var err error
+		format, err = imaging.NormalizeFormat(renderOptions.Format)
+		if err != nil {
+			return imaging.Options{}, apperror.BadRequest("%v", err)
+		}
+	}
+
+	quality := renderOptions.Quality
+	if quality == 0 {
+		quality = render.DefaultQuality
+	} else if !slices.Contains(render.AllowedQualities, quality) {
+		return imaging.Options{}, apperror.BadRequest("quality %d is not allowed", quality)
+	}
+
+	return imaging.Options{
+		Width:   renderOptions.Width,
+		Height:  renderOptions.Height,
+		Fit:     fit,
+		Format:  format,
+		Quality: quality,
+	}, nil
+}
+
+// renderCacheKey names a render after the source file and every option that
+// affects its bytes. The key starts with renderCachePrefix of the job so its
+// renders can be removed together.
+func renderCacheKey(job dto.ImageJob, opts imaging.Options) string {
+	raw := fmt.Sprintf("%d|%s|%d|%d|%s|%s|%d", job.ID, job.Filename, opts.Width, opts.Height, opts.Fit, opts.Format, opts.Quality)
+	sum := sha256.Sum256([]byte(raw))
+	return renderCachePrefix(job.ID) + hex.EncodeToString(sum[:16]) + imaging.Extension(opts.Format)
+}
+
+func renderCachePrefix(jobID int64) string {
+	return fmt.Sprintf("%d-", jobID)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"shared/imaging"
+)
+
+func TestValidateRenderOptions(t *testing.T) {
+	s := &service{conf: &serviceConfig{render: config.RenderConfig{
+		AllowedSizes:     []string{"160x160", "640x480"},
+		AllowedQualities: []int{50, 85},
+		DefaultQuality:   70,
+	}}}
+
+	tests := []struct {
+		name    string
+		request dto.RenderOptions
+		want    imaging.Options
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			request: dto.RenderOptions{Width: 160, Height: 160},
+			want:    imaging.Options{Width: 160, Height: 160, Fit: imaging.FitContain, Quality: 70},
+		},
+		{
+			name:    "every option allowed",
+			request: dto.RenderOptions{Width: 640, Height: 480, Fit: "cover", Format: "jpg", Quality: 85},
+			want:    imaging.Options{Width: 640, Height: 480, Fit: imaging.FitCover, Format: imaging.FormatJPEG, Quality: 85},
+		},
+		{"size not allowed", dto.RenderOptions{Width: 480, Height: 640}, imaging.Options{}, true},
+		{"unknown fit", dto.RenderOptions{Width: 160, Height: 160, Fit: "stretch"}, imaging.Options{}, true},
+		{"unsupported format", dto.RenderOptions{Width: 160, Height: 160, Format: "gif"}, imaging.Options{}, true},
+		{"quality not allowed", dto.RenderOptions{Width: 160, Height: 160, Quality: 70}, imaging.Options{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.validateRenderOptions(tt.request)
+
+			if tt.wantErr {
+				if status := apperror.Status(err, 0); status != http.StatusBadRequest {
+					t.Errorf("validateRenderOptions(%+v) error %v with status %d, want %d", tt.request, err, status, http.StatusBadRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateRenderOptions(%+v) unexpected error: %v", tt.request, err)
+			}
+			if got != tt.want {
+				t.Errorf("validateRenderOptions(%+v) = %+v, want %+v", tt.request, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderCacheKey(t *testing.T) {
+	job := dto.ImageJob{ID: 12, Filename: "cat-1700000000.png"}
+	opts := imaging.Options{Width: 160, Height: 160, Fit: imaging.FitContain, Format: imaging.FormatPNG, Quality: 70}
+	key := renderCacheKey(job, opts)
+
+	if !strings.HasPrefix(key, renderCachePrefix(job.ID)) || !strings.HasSuffix(key, ".png") {
+		t.Errorf("renderCacheKey = %s, want prefix %s and suffix .png", key, renderCachePrefix(job.ID))
+	}
+	// Job 1's prefix must not select job 12's renders
+	if strings.HasPrefix(key, renderCachePrefix(1)) {
+		t.Errorf("renderCacheKey = %s matches the prefix of job 1", key)
+	}
+
+	changed := opts
+	changed.Quality = 50
+	if renderCacheKey(job, changed) == key {
+		t.Error("renders at different qualities share a cache key")
+	}
+	if renderCacheKey(job, opts) != key {
+		t.Error("renderCacheKey is not stable for the same options")
+	}
+}
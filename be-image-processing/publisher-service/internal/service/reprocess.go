@@ -0,0 +1,199 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"publisher-service/internal/apperror"
+	"publisher-service/internal/config"
+	"publisher-service/internal/repository"
+	"publisher-service/pkg/dto"
+	"shared/imaging"
+	"shared/jobstate"
+	"time"
+)
+
+const (
+	logTagReprocess = "[Reprocess]"
+
+	// maxProcessingDimension bounds the width and height a reprocess may ask for
+	maxProcessingDimension = 8192
+)
+
+// Outcomes reported per job by a bulk reprocess
+const (
+	outcomeReprocessed    = "reprocessed"
+	outcomeWouldReprocess = "would_reprocess"
+)
+
+// ReprocessJob regenerates the output of a completed job from its retained
+// original with the given options. The job stays completed and its current
+// output keeps being served until the new revision completes; a revision
+// that fails leaves both as they are.
+func (s *service) ReprocessJob(id int64, reprocessRequest dto.ReprocessRequest) (reprocessJobResponse dto.ReprocessJobResponse, err error) {
+	opts, err := validateProcessingOptions(reprocessRequest.Options)
+	if err != nil {
+		return reprocessJobResponse, err
+	}
+
+	job, err := s.repository.GetImageJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return reprocessJobResponse, apperror.NotFound("job not found")
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fetching job %d: %v", logTagReprocess, id, err))
+		return reprocessJobResponse, err
+	}
+
+	if reason := reprocessBlocker(job); reason != "" {
+		if job.OriginalPurgedAt != nil {
+			return reprocessJobResponse, apperror.Gone("%s", reason)
+		}
+		return reprocessJobResponse, apperror.Conflict("%s", reason)
+	}
+
+	revision, err := s.reprocessJob(job, opts, 0)
+	if errors.Is(err, repository.ErrJobNotCompleted) || errors.Is(err, repository.ErrRevisionPending) {
+		return reprocessJobResponse, apperror.Conflict("%v", err)
+	}
+	if errors.Is(err, jobstate.ErrJobNotFound) {
+		return reprocessJobResponse, apperror.NotFound("job not found")
+	}
+	if err != nil {
+		return reprocessJobResponse, err
+	}
+
+	return dto.ReprocessJobResponse{ID: id, Revision: revision}, nil
+}
+
+// ReprocessJobs reprocesses the completed jobs matching the filter like
+// ReprocessJob and reports the outcome for each of them. Their outbox messages
+// take pacing slots at the bulk retry rate like a bulk retry.
+func (s *service) ReprocessJobs(bulkReprocessRequest dto.BulkReprocessRequest) (bulkJobResponse dto.BulkJobResponse, err error) {
+	bulkJobResponse = dto.BulkJobResponse{DryRun: bulkReprocessRequest.DryRun, Results: []dto.BulkJobResult{}}
+
+	opts, err := validateProcessingOptions(bulkReprocessRequest.Options)
+	if err != nil {
+		return bulkJobResponse, err
+	}
+
+	jobs, err := s.findJobs(&bulkReprocessRequest.JobFilter)
+	if err != nil {
+		return bulkJobResponse, err
+	}
+	bulkJobResponse.Matched = len(jobs)
+
+	interval := time.Duration(float64(time.Second) / s.conf.bulkRetry.Rate)
+
+	for _, job := range jobs {
+		result := dto.BulkJobResult{ID: job.ID, Outcome: outcomeReprocessed}
+
+		if reason := reprocessBlocker(job); reason != "" {
+			result.Outcome = outcomeSkipped
+			result.Error = reason
+			bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+			continue
+		}
+
+		if bulkReprocessRequest.DryRun {
+			result.Outcome = outcomeWouldReprocess
+			bulkJobResponse.Count++
+			bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+			continue
+		}
+
+		_, err := s.reprocessJob(job, opts, interval)
+
+		switch {
+		case err == nil:
+			bulkJobResponse.Count++
+		case errors.Is(err, repository.ErrJobNotCompleted) || errors.Is(err, repository.ErrRevisionPending):
+			// The job changed since it was selected
+			result.Outcome = outcomeSkipped
+			result.Error = err.Error()
+		case errors.Is(err, jobstate.ErrJobNotFound):
+			result.Outcome = outcomeNotFound
+		default:
+			result.Outcome = outcomeError
+			result.Error = err.Error()
+		}
+		bulkJobResponse.Results = append(bulkJobResponse.Results, result)
+	}
+
+	return bulkJobResponse, nil
+}
+
+func (s *service) reprocessJob(job dto.ImageJob, opts imaging.Options, pace time.Duration) (int, error) {
+	revision, err := s.repository.ReprocessJob(job.ID, opts, pace, actorAPI, "reprocess requested")
+	if err != nil {
+		if !errors.Is(err, repository.ErrJobNotCompleted) && !errors.Is(err, repository.ErrRevisionPending) && !errors.Is(err, jobstate.ErrJobNotFound) {
+			slog.Error(fmt.Sprintf("%s reprocessing job %d: %v", logTagReprocess, job.ID, err))
+		}
+		return 0, err
+	}
+
+	// An output an earlier reprocess replaced but the sweep has not removed
+	// yet would be forgotten once the new revision replaces the current
+	// output, so it is removed now that the reprocess is committed
+	if previous := job.PreviousCompressedFileName; previous != nil && job.CompressedFileName != nil && *previous != *job.CompressedFileName {
+		if s.removeOutputFiles(job.ID, *previous) == nil {
+			if err := s.repository.ClearPreviousOutput(job.ID, *previous); err != nil {
+				slog.Error(fmt.Sprintf("%s forgetting output %s of job %d: %v", logTagReprocess, *previous, job.ID, err))
+			}
+		}
+	}
+
+	slog.Info(fmt.Sprintf("%s job %d queued for revision %d", logTagReprocess, job.ID, revision))
+	return revision, nil
+}
+
+// reprocessBlocker returns why job cannot be reprocessed, or "" if it can
+func reprocessBlocker(job dto.ImageJob) string {
+	if job.Status != string(jobstate.Completed) {
+		return fmt.Sprintf("job is %s; only completed jobs can be reprocessed", job.Status)
+	}
+	if job.OriginalPurgedAt != nil {
+		return "original has expired"
+	}
+	if job.PendingRevision != nil {
+		return fmt.Sprintf("revision %d: %v", *job.PendingRevision, repository.ErrRevisionPending)
+	}
+	return ""
+}
+
+// validateProcessingOptions checks the options of a new revision and
+// normalizes the format. Zero values keep the worker's defaults.
+func validateProcessingOptions(opts imaging.Options) (imaging.Options, error) {
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return opts, apperror.BadRequest("quality must be between 1 and 100")
+	}
+	if opts.Width > maxProcessingDimension || opts.Height > maxProcessingDimension {
+		return opts, apperror.BadRequest("width and height cannot exceed %d", maxProcessingDimension)
+	}
+	if opts.Fit != "" && !imaging.IsValidFit(opts.Fit) {
+		return opts, apperror.BadRequest("invalid fit: %s", opts.Fit)
+	}
+	if opts.Format != "" {
+		format, err := imaging.NormalizeFormat(opts.Format)
+		if err != nil {
+			return opts, apperror.BadRequest("%v", err)
+		}
+		opts.Format = format
+	}
+	return opts, nil
+}
+
+// removeOutputFiles deletes a compressed output and its variants
+func (s *service) removeOutputFiles(jobID int64, compressedFileName string) error {
+	var failed error
+	names := append([]string{compressedFileName}, compressedVariantNames(compressedFileName)...)
+	for _, name := range names {
+		if err := removeStoredFile(filepath.Join(config.CompressedDir, name)); err != nil {
+			slog.Error(fmt.Sprintf("%s removing output %s of job %d: %v", logTagReprocess, name, jobID, err))
+			failed = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"publisher-service/internal/config"
+	"publisher-service/pkg/dto"
+	"time"
+)
+
+const logTagRetention = "[Retention]"
+
+// PurgeExpiredFiles deletes originals and compressed outputs that are past
+// their configured retention and marks the job rows as purged. Outputs
+// replaced by a completed reprocess are deleted on every sweep.
+func (s *service) PurgeExpiredFiles() (retentionSweepResponse dto.RetentionSweepResponse, err error) {
+	retention := s.conf.retention
+
+	if retention.OriginalRetentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -retention.OriginalRetentionDays)
+		jobs, err := s.repository.GetOriginalsToPurge(before, !retention.KeepFailedOriginals, retention.SweepBatchSize)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s fetching originals to purge: %v", logTagRetention, err))
+			return retentionSweepResponse, err
+		}
+
+		for _, job := range jobs {
+			if err := removeStoredFile(filepath.Join(config.UploadsDir, job.Filename)); err != nil {
+				slog.Error(fmt.Sprintf("%s removing original of job %d: %v", logTagRetention, job.ID, err))
+				continue
+			}
+
+			if err := s.repository.MarkOriginalPurged(job.ID); err != nil {
+				slog.Error(fmt.Sprintf("%s marking original of job %d purged: %v", logTagRetention, job.ID, err))
+				continue
+			}
+			retentionSweepResponse.OriginalsPurged++
+		}
+	}
+
+	if retention.OutputRetentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -retention.OutputRetentionDays)
+		jobs, err := s.repository.GetOutputsToPurge(before, retention.SweepBatchSize)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s fetching outputs to purge: %v", logTagRetention, err))
+			return retentionSweepResponse, err
+		}
+
+		for _, job := range jobs {
+			if err := removeStoredFile(filepath.Join(config.CompressedDir, *job.CompressedFileName)); err != nil {
+				slog.Error(fmt.Sprintf("%s removing output of job %d: %v", logTagRetention, job.ID, err))
+				continue
+			}
+
+			for _, variant := range compressedVariantNames(*job.CompressedFileName) {
+				if err := removeStoredFile(filepath.Join(config.CompressedDir, variant)); err != nil {
+					slog.Error(fmt.Sprintf("%s removing output variant %s of job %d: %v", logTagRetention, variant, job.ID, err))
+				}
+			}
+
+			if err := s.repository.MarkCompressedPurged(job.ID); err != nil {
+				slog.Error(fmt.Sprintf("%s marking output of job %d purged: %v", logTagRetention, job.ID, err))
+				continue
+			}
+			retentionSweepResponse.OutputsPurged++
+		}
+	}
+
+	jobs, err := s.repository.GetSupersededOutputs(retention.SweepBatchSize)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fetching superseded outputs: %v", logTagRetention, err))
+		return retentionSweepResponse, err
+	}
+
+	for _, job := range jobs {
+		previous := *job.PreviousCompressedFileName
+		if err := s.removeOutputFiles(job.ID, previous); err != nil {
+			continue
+		}
+
+		if err := s.repository.ClearPreviousOutput(job.ID, previous); err != nil {
+			slog.Error(fmt.Sprintf("%s clearing superseded output of job %d: %v", logTagRetention, job.ID, err))
+			continue
+		}
+		retentionSweepResponse.SupersededPurged++
+	}
+
+	if retentionSweepResponse.OriginalsPurged > 0 || retentionSweepResponse.OutputsPurged > 0 || retentionSweepResponse.SupersededPurged > 0 {
+		slog.Info(fmt.Sprintf("%s purged %d originals, %d outputs and %d superseded outputs", logTagRetention,
+			retentionSweepResponse.OriginalsPurged, retentionSweepResponse.OutputsPurged, retentionSweepResponse.SupersededPurged))
+	}
+
+	return retentionSweepResponse, nil
+}
+
+// removeStoredFile deletes a file, treating an already missing file as removed
+func removeStoredFile(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"publisher-service/pkg/dto"
+)
+
+const logTagScheduler = "[Scheduler]"
+
+// EnqueueDueJobs hands scheduled jobs that are due to the outbox relay. The
+// schedule lives in the job rows, so jobs that came due while the publisher
+// was down are enqueued on the first run after it starts.
+func (s *service) EnqueueDueJobs() (scheduleResponse dto.ScheduleResponse, err error) {
+	scheduleResponse.Enqueued, err = s.repository.EnqueueDueJobs(s.conf.scheduler.BatchSize)
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s enqueueing due jobs: %v", logTagScheduler, err))
+		return dto.ScheduleResponse{Enqueued: []int64{}}, err
+	}
+
+	if len(scheduleResponse.Enqueued) > 0 {
+		slog.Info(fmt.Sprintf("%s enqueued %v", logTagScheduler, scheduleResponse.Enqueued))
+	}
+	return scheduleResponse, nil
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"publisher-service/pkg/dto"
+	"time"
+)
+
+func (s *service) GetStats() (statsResponse dto.StatsResponse) {
+	pool := s.rabbitmq.PoolStats()
+
+	return dto.StatsResponse{
+		PublishChannelPool: dto.ChannelPoolStats{
+			Size:          pool.Size,
+			InUse:         pool.InUse,
+			Idle:          pool.Idle,
+			Acquires:      pool.Acquires,
+			Timeouts:      pool.Timeouts,
+			Created:       pool.Created,
+			AverageWaitMs: float64(pool.AverageWait) / float64(time.Millisecond),
+			MaxWaitMs:     float64(pool.MaxWait) / float64(time.Millisecond),
+		},
+	}
+}
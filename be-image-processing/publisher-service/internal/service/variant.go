@@ -0,0 +1,91 @@
+package service
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"publisher-service/internal/util/ginhttputil"
+	"strings"
+)
+
+type compressedVariant struct {
+	mediaType string
+	extension string
+}
+
+// compressedVariants are the formats the worker generates next to each
+// compressed output, in server preference order. A variant that came out no
+// smaller than its output is not stored.
+var compressedVariants = []compressedVariant{
+	{mediaType: "image/webp", extension: ".webp"},
+}
+
+// outputExtensions are the extensions a compressed output may have
+var outputExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// compressedVariantNames returns the file names the variants of a compressed
+// output would have
+func compressedVariantNames(filename string) []string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	var names []string
+	for _, variant := range compressedVariants {
+		if name := base + variant.extension; name != filename {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// variantSourceNames returns the names of the outputs filename may be a
+// variant of, or nil when it is not named like a variant
+func variantSourceNames(filename string) []string {
+	ext := filepath.Ext(filename)
+	for _, variant := range compressedVariants {
+		if ext != variant.extension {
+			continue
+		}
+
+		base := strings.TrimSuffix(filename, ext)
+		names := make([]string, 0, len(outputExtensions))
+		for _, outputExt := range outputExtensions {
+			names = append(names, base+outputExt)
+		}
+		return names
+	}
+	return nil
+}
+
+// negotiateCompressedVariant returns the path of the variant of filename in
+// dir that best matches accept, or "" when the requested file itself should
+// be served
+func negotiateCompressedVariant(dir string, filename string, accept string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	var offers []string
+	paths := map[string]string{}
+	for _, variant := range compressedVariants {
+		// Only clients that ask for a format by name get it, not "*/*"
+		if !ginhttputil.ExplicitlyAccepts(accept, variant.mediaType) {
+			continue
+		}
+
+		path := filepath.Join(dir, base+variant.extension)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		offers = append(offers, variant.mediaType)
+		paths[variant.mediaType] = path
+	}
+
+	if len(offers) == 0 {
+		return ""
+	}
+
+	// The requested format comes last so it only wins when the client prefers it
+	if original := mime.TypeByExtension(filepath.Ext(filename)); original != "" {
+		offers = append(offers, original)
+	}
+
+	return paths[ginhttputil.PreferredMediaType(accept, offers)]
+}
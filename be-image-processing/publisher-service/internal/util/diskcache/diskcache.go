@@ -0,0 +1,203 @@
+package diskcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logTagDiskCache = "[DiskCache]"
+	tmpPrefix       = ".tmp-"
+)
+
+// Cache is a directory of files bounded by total size. When a new file pushes
+// the total over maxBytes, the least recently used files are removed.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// New creates the cache directory if needed and indexes the files already in
+// it, oldest modification time first, so a restart keeps the previous cache.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache directory %s: %w", dir, err)
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache directory %s: %w", dir, err)
+	}
+
+	type existing struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []existing
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.Type().IsRegular() {
+			continue
+		}
+		// Leftover from a write interrupted by a crash
+		if strings.HasPrefix(dirEntry.Name(), tmpPrefix) {
+			os.Remove(filepath.Join(dir, dirEntry.Name()))
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, existing{key: dirEntry.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		c.entries[file.key] = c.order.PushFront(&entry{key: file.key, size: file.size})
+		c.size += file.size
+	}
+	c.evictLocked()
+
+	return c, nil
+}
+
+// Path returns where the file for key lives in the cache directory
+func (c *Cache) Path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// Get opens the cached file for key and marks it as recently used. The file
+// is opened while the cache is locked, so it stays readable after a later Put
+// evicts it. The caller closes it.
+func (c *Cache) Get(key string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	file, err := os.Open(c.Path(key))
+	if err != nil {
+		c.removeLocked(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return file, true
+}
+
+// Put stores the output of write under key and opens the stored file like
+// Get. The file is written to a temporary name first so readers never see a
+// partial file.
+func (c *Cache) Put(key string, write func(w io.Writer) error) (*os.File, error) {
+	tmp, err := os.CreateTemp(c.dir, tmpPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp cache file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("stat temp cache file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("close temp cache file: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmpPath, c.Path(key)); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("move cache file into place: %w", err)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.size -= element.Value.(*entry).size
+		element.Value.(*entry).size = info.Size()
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(&entry{key: key, size: info.Size()})
+	}
+	c.size += info.Size()
+
+	file, err := os.Open(c.Path(key))
+	if err != nil {
+		return nil, fmt.Errorf("open cache file: %w", err)
+	}
+	c.evictLocked()
+
+	return file, nil
+}
+
+// RemovePrefix removes every file whose key starts with prefix and returns
+// the paths they were cached at
+func (c *Cache) RemovePrefix(prefix string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var removed []string
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			removed = append(removed, c.Path(key))
+			c.removeLocked(element)
+		}
+	}
+	return removed
+}
+
+// evictLocked removes least recently used files until the cache fits, always
+// keeping the most recent entry
+func (c *Cache) evictLocked() {
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+func (c *Cache) removeLocked(element *list.Element) {
+	e := element.Value.(*entry)
+	if err := os.Remove(c.Path(e.key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error(fmt.Sprintf("%s removing %s: %v", logTagDiskCache, e.key, err))
+	}
+	c.order.Remove(element)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
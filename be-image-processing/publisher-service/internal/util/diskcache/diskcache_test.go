@@ -0,0 +1,181 @@
+package diskcache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func put(t *testing.T, c *Cache, key, content string) {
+	t.Helper()
+	file, err := c.Put(key, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+	file.Close()
+}
+
+func cached(c *Cache, key string) bool {
+	file, ok := c.Get(key)
+	if ok {
+		file.Close()
+	}
+	return ok
+}
+
+func TestCacheEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		steps    func(t *testing.T, c *Cache)
+		want     map[string]bool
+	}{
+		{
+			name:     "least recently put is evicted",
+			maxBytes: 10,
+			steps: func(t *testing.T, c *Cache) {
+				put(t, c, "a", "aaaa")
+				put(t, c, "b", "bbbb")
+				put(t, c, "c", "cccc")
+			},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{
+			name:     "get marks an entry recently used",
+			maxBytes: 10,
+			steps: func(t *testing.T, c *Cache) {
+				put(t, c, "a", "aaaa")
+				put(t, c, "b", "bbbb")
+				cached(c, "a")
+				put(t, c, "c", "cccc")
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name:     "replacing an entry counts its new size only",
+			maxBytes: 10,
+			steps: func(t *testing.T, c *Cache) {
+				put(t, c, "a", "aaaa")
+				put(t, c, "b", "bbbb")
+				put(t, c, "a", "aa")
+				put(t, c, "c", "cccc")
+			},
+			want: map[string]bool{"a": true, "b": true, "c": true},
+		},
+		{
+			name:     "newest entry is kept even when it alone is too large",
+			maxBytes: 10,
+			steps: func(t *testing.T, c *Cache) {
+				put(t, c, "a", "aaaa")
+				put(t, c, "big", strings.Repeat("x", 20))
+			},
+			want: map[string]bool{"a": false, "big": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(t.TempDir(), tt.maxBytes)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			tt.steps(t, c)
+
+			for key, want := range tt.want {
+				if got := cached(c, key); got != want {
+					t.Errorf("cached %s = %t, want %t", key, got, want)
+				}
+				if _, err := os.Stat(c.Path(key)); (err == nil) != want {
+					t.Errorf("file for %s exists = %t, want %t", key, err == nil, want)
+				}
+			}
+		})
+	}
+}
+
+// A file handed out by Get stays readable after a Put evicts it
+func TestCacheEvictedFileStaysOpen(t *testing.T) {
+	c, err := New(t.TempDir(), 4)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	put(t, c, "a", "aaaa")
+
+	file, ok := c.Get("a")
+	if !ok {
+		t.Fatal("Get(a) missed a stored entry")
+	}
+	defer file.Close()
+	put(t, c, "b", "bbbb")
+
+	if cached(c, "a") {
+		t.Fatal("a still cached, want it evicted")
+	}
+	content, err := io.ReadAll(file)
+	if err != nil || string(content) != "aaaa" {
+		t.Errorf("reading evicted file = %q, %v; want %q", content, err, "aaaa")
+	}
+}
+
+func TestCacheRemovePrefix(t *testing.T) {
+	c, err := New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, key := range []string{"1-a.jpg", "1-b.png", "12-a.jpg"} {
+		put(t, c, key, key)
+	}
+
+	removed := c.RemovePrefix("1-")
+	slices.Sort(removed)
+	want := []string{c.Path("1-a.jpg"), c.Path("1-b.png")}
+	if !slices.Equal(removed, want) {
+		t.Errorf("RemovePrefix(1-) = %v, want %v", removed, want)
+	}
+	if !cached(c, "12-a.jpg") {
+		t.Error("RemovePrefix(1-) removed 12-a.jpg")
+	}
+}
+
+// A restart indexes the previous files oldest first and drops partial writes
+func TestNewIndexesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"old", now.Add(-2 * time.Hour)},
+		{"recent", now.Add(-time.Hour)},
+		{tmpPrefix + "123", now},
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, []byte("1234"), 0644); err != nil {
+			t.Fatalf("write %s: %v", file.name, err)
+		}
+		if err := os.Chtimes(path, file.modTime, file.modTime); err != nil {
+			t.Fatalf("touch %s: %v", file.name, err)
+		}
+	}
+
+	c, err := New(dir, 8)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, tmpPrefix+"123")); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+
+	put(t, c, "new", "1234")
+	if cached(c, "old") || !cached(c, "recent") || !cached(c, "new") {
+		t.Errorf("old %t, recent %t, new %t; want only old evicted", cached(c, "old"), cached(c, "recent"), cached(c, "new"))
+	}
+}
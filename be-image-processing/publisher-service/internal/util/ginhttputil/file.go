@@ -0,0 +1,156 @@
+package ginhttputil
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderETag         = "ETag"
+	HeaderCacheControl = "Cache-Control"
+)
+
+// maxFileETags bounds how many content hashes are cached. A hash is 64 bytes
+// plus its path, so the cache stays at a few megabytes.
+const maxFileETags = 10000
+
+type fileETag struct {
+	path    string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// etagCache caches content hashes by path so unchanged files are only hashed
+// once. Entries are revalidated against size and modification time, and the
+// least recently served path is evicted once the cache is full.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+var fileETags = &etagCache{entries: map[string]*list.Element{}, order: list.New()}
+
+func (c *etagCache) get(path string) (fileETag, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[path]
+	if !ok {
+		return fileETag{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(fileETag), true
+}
+
+func (c *etagCache) put(entry fileETag) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.path]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.path] = c.order.PushFront(entry)
+	for c.order.Len() > maxFileETags {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(fileETag).path)
+	}
+}
+
+func (c *etagCache) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[path]; ok {
+		c.order.Remove(element)
+		delete(c.entries, path)
+	}
+}
+
+// ForgetFileETags drops the cached content hashes of deleted files
+func ForgetFileETags(paths ...string) {
+	for _, path := range paths {
+		fileETags.forget(path)
+	}
+}
+
+// WriteFileResponse serves the file at path with a strong ETag derived from
+// its content and the given Cache-Control policy. Conditional requests
+// (If-None-Match, If-Modified-Since) and Range requests are answered by
+// http.ServeContent.
+func WriteFileResponse(g *gin.Context, path string, cacheControl string) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			WriteErrorResponse(g, http.StatusNotFound, errors.New("image not found"))
+			return
+		}
+		WriteErrorResponse(g, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	WriteOpenFileResponse(g, file, cacheControl)
+}
+
+// WriteOpenFileResponse serves an already opened file like WriteFileResponse,
+// for files that may be removed from their path while they are served. The
+// caller closes the file.
+func WriteOpenFileResponse(g *gin.Context, file *os.File, cacheControl string) {
+	path := file.Name()
+
+	info, err := file.Stat()
+	if err != nil {
+		WriteErrorResponse(g, http.StatusInternalServerError, err)
+		return
+	}
+
+	etag, err := contentETag(path, file, info)
+	if err != nil {
+		WriteErrorResponse(g, http.StatusInternalServerError, err)
+		return
+	}
+
+	g.Header(HeaderETag, etag)
+	if cacheControl != "" {
+		g.Header(HeaderCacheControl, cacheControl)
+	}
+
+	http.ServeContent(g.Writer, g.Request, info.Name(), info.ModTime(), file)
+}
+
+func contentETag(path string, file *os.File, info os.FileInfo) (string, error) {
+	if entry, ok := fileETags.get(path); ok {
+		if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			return entry.etag, nil
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("hash file: %w", err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("rewind file: %w", err)
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	fileETags.put(fileETag{path: path, size: info.Size(), modTime: info.ModTime(), etag: etag})
+
+	return etag, nil
+}
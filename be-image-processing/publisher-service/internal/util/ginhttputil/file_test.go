@@ -0,0 +1,143 @@
+package ginhttputil
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETagCacheEvictsLeastRecentlyServed(t *testing.T) {
+	cache := &etagCache{entries: map[string]*list.Element{}, order: list.New()}
+	for i := range maxFileETags {
+		cache.put(fileETag{path: fmt.Sprintf("/app/compressed/%d.jpg", i), etag: fmt.Sprintf(`"%d"`, i)})
+	}
+
+	// Serving the oldest entry makes the second oldest the next to go
+	if _, ok := cache.get("/app/compressed/0.jpg"); !ok {
+		t.Fatal("entry 0 missing before the cache is full")
+	}
+	cache.put(fileETag{path: "/app/compressed/new.jpg", etag: `"new"`})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/app/compressed/0.jpg", true},
+		{"/app/compressed/1.jpg", false},
+		{"/app/compressed/2.jpg", true},
+		{"/app/compressed/new.jpg", true},
+	}
+	for _, tt := range tests {
+		if _, ok := cache.get(tt.path); ok != tt.want {
+			t.Errorf("cached %s = %t, want %t", tt.path, ok, tt.want)
+		}
+	}
+	if cache.order.Len() != maxFileETags || len(cache.entries) != maxFileETags {
+		t.Errorf("cache holds %d entries (%d indexed), want %d", cache.order.Len(), len(cache.entries), maxFileETags)
+	}
+
+	cache.forget("/app/compressed/new.jpg")
+	if _, ok := cache.get("/app/compressed/new.jpg"); ok {
+		t.Error("forgotten entry still cached")
+	}
+}
+
+func serveFile(path string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	gn := gin.New()
+	gn.GET("/images-compressed/cat.jpg", func(g *gin.Context) {
+		WriteFileResponse(g, path, "public, max-age=60")
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/images-compressed/cat.jpg", nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response := httptest.NewRecorder()
+	gn.ServeHTTP(response, request)
+	return response
+}
+
+func TestWriteFileResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cat.jpg")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	etag := serveFile(path, nil).Header().Get(HeaderETag)
+	if etag == "" {
+		t.Fatal("no ETag on the response")
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{"plain request", nil, http.StatusOK, "0123456789"},
+		{"matching If-None-Match", map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{"stale If-None-Match", map[string]string{"If-None-Match": `"stale"`}, http.StatusOK, "0123456789"},
+		{"range", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "2345"},
+		{"range for the current version", map[string]string{"Range": "bytes=2-5", "If-Range": etag}, http.StatusPartialContent, "2345"},
+		{"range for an old version", map[string]string{"Range": "bytes=2-5", "If-Range": `"stale"`}, http.StatusOK, "0123456789"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=20-30"}, http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serveFile(path, tt.headers)
+
+			if response.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && response.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", response.Body.String(), tt.wantBody)
+			}
+			if response.Code >= http.StatusBadRequest {
+				return
+			}
+			if got := response.Header().Get(HeaderETag); got != etag {
+				t.Errorf("ETag = %s, want %s", got, etag)
+			}
+			if got := response.Header().Get(HeaderCacheControl); got != "public, max-age=60" {
+				t.Errorf("Cache-Control = %q, want the configured policy", got)
+			}
+		})
+	}
+}
+
+// A file rewritten in place gets a new ETag even though its path is cached
+func TestWriteFileResponseRehashesChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cat.jpg")
+	if err := os.WriteFile(path, []byte("first"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	first := serveFile(path, nil).Header().Get(HeaderETag)
+
+	if err := os.WriteFile(path, []byte("second version"), 0644); err != nil {
+		t.Fatalf("rewrite file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("touch file: %v", err)
+	}
+
+	response := serveFile(path, map[string]string{"If-None-Match": first})
+	if response.Code != http.StatusOK || response.Header().Get(HeaderETag) == first {
+		t.Errorf("status %d with ETag %s, want 200 with a new ETag", response.Code, response.Header().Get(HeaderETag))
+	}
+}
+
+func TestWriteFileResponseMissingFile(t *testing.T) {
+	response := serveFile(filepath.Join(t.TempDir(), "missing.jpg"), nil)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,110 @@
+package ginhttputil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime/multipart"
+	"slices"
+	"strings"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// HashRequest fingerprints the method, path and body of the request, so a
+// repeat can be told apart from a different request under the same
+// Idempotency-Key. Multipart bodies are hashed by their fields and file
+// contents rather than their raw bytes, since clients pick a new boundary on
+// every attempt. The body stays readable for the handlers that follow.
+func HashRequest(g *gin.Context) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", g.Request.Method, g.Request.URL.Path)
+
+	if strings.HasPrefix(g.ContentType(), gin.MIMEMultipartPOSTForm) {
+		form, err := g.MultipartForm()
+		if err != nil {
+			return "", err
+		}
+		if err = hashMultipartForm(hash, form); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	if g.Request.Body != nil {
+		body, err := io.ReadAll(g.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		g.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashMultipartForm(w io.Writer, form *multipart.Form) error {
+	names := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "value %q %q\n", name, form.Value[name])
+	}
+
+	names = names[:0]
+	for name := range form.File {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, header := range form.File[name] {
+			fmt.Fprintf(w, "file %q %q %d\n", name, header.Filename, header.Size)
+
+			file, err := header.Open()
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResponseRecorder passes the response through to the client and keeps a copy
+// of the body
+type ResponseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func NewResponseRecorder(w gin.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+func (w *ResponseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *ResponseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Body returns what was written so far
+func (w *ResponseRecorder) Body() []byte {
+	return w.body.Bytes()
+}
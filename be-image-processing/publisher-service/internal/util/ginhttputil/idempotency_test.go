@@ -0,0 +1,97 @@
+package ginhttputil
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func hashOf(t *testing.T, request *http.Request) string {
+	t.Helper()
+
+	g, _ := gin.CreateTestContext(httptest.NewRecorder())
+	g.Request = request
+
+	hash, err := HashRequest(g)
+	if err != nil {
+		t.Fatalf("HashRequest: %v", err)
+	}
+	return hash
+}
+
+func multipartRequest(t *testing.T, fields [][2]string, fileName, fileBody string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, field := range fields {
+		w.WriteField(field[0], field[1])
+	}
+	if fileName != "" {
+		part, err := w.CreateFormFile("image", fileName)
+		if err != nil {
+			t.Fatalf("CreateFormFile: %v", err)
+		}
+		io.WriteString(part, fileBody)
+	}
+	w.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/images", &body)
+	request.Header.Set("Content-Type", w.FormDataContentType())
+	return request
+}
+
+func TestHashRequest(t *testing.T) {
+	jsonRequest := func(method, path, body string) *http.Request {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		return request
+	}
+	upload := func() *http.Request {
+		return multipartRequest(t, [][2]string{{"quality", "80"}, {"format", "webp"}}, "cat.jpg", "cat")
+	}
+
+	tests := []struct {
+		name  string
+		a, b  *http.Request
+		equal bool
+	}{
+		{"same body", jsonRequest(http.MethodPost, "/jobs/1/retry", `{"a":1}`), jsonRequest(http.MethodPost, "/jobs/1/retry", `{"a":1}`), true},
+		{"different body", jsonRequest(http.MethodPost, "/jobs/1/retry", `{"a":1}`), jsonRequest(http.MethodPost, "/jobs/1/retry", `{"a":2}`), false},
+		{"different path", jsonRequest(http.MethodPost, "/jobs/1/retry", ""), jsonRequest(http.MethodPost, "/jobs/2/retry", ""), false},
+		{"different method", jsonRequest(http.MethodPost, "/jobs/1", ""), jsonRequest(http.MethodDelete, "/jobs/1", ""), false},
+		{"multipart with a new boundary", upload(), upload(), true},
+		{"multipart field order", upload(), multipartRequest(t, [][2]string{{"format", "webp"}, {"quality", "80"}}, "cat.jpg", "cat"), true},
+		{"multipart field value", upload(), multipartRequest(t, [][2]string{{"quality", "90"}, {"format", "webp"}}, "cat.jpg", "cat"), false},
+		{"multipart file contents", upload(), multipartRequest(t, [][2]string{{"quality", "80"}, {"format", "webp"}}, "cat.jpg", "dog"), false},
+		{"multipart file name", upload(), multipartRequest(t, [][2]string{{"quality", "80"}, {"format", "webp"}}, "dog.jpg", "cat"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashOf(t, tt.a) == hashOf(t, tt.b); got != tt.equal {
+				t.Errorf("hashes equal = %t, want %t", got, tt.equal)
+			}
+		})
+	}
+}
+
+// Handlers after the idempotency middleware read the body again
+func TestHashRequestKeepsBody(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/jobs/1/reprocess", strings.NewReader(`{"quality":80}`))
+	hashOf(t, request)
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if string(body) != `{"quality":80}` {
+		t.Errorf("body = %q, want the original body", body)
+	}
+}
@@ -0,0 +1,88 @@
+package ginhttputil
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderVary   = "Vary"
+	HeaderAccept = "Accept"
+)
+
+// PreferredMediaType picks the offer the Accept header ranks highest. Offers
+// are listed in server preference order, which breaks ties between equal
+// q-values. It returns "" when none of the offers are acceptable.
+func PreferredMediaType(accept string, offers []string) string {
+	best := ""
+	bestQ := 0.0
+
+	for _, offer := range offers {
+		q, _ := acceptQuality(accept, offer)
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// ExplicitlyAccepts reports whether the Accept header names mediaType itself
+// with a non-zero q-value, rather than only matching it through a wildcard
+func ExplicitlyAccepts(accept string, mediaType string) bool {
+	q, specificity := acceptQuality(accept, mediaType)
+	return q > 0 && specificity == specificityExact
+}
+
+const (
+	specificityNone = iota - 1
+	specificityAny
+	specificitySubtype
+	specificityExact
+)
+
+// acceptQuality returns the q-value the Accept header gives mediaType, using
+// the most specific matching range, along with that range's specificity
+func acceptQuality(accept string, mediaType string) (float64, int) {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	quality := 0.0
+	specificity := specificityNone
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var rangeSpecificity int
+		switch {
+		case mediaRange == mediaType:
+			rangeSpecificity = specificityExact
+		case mediaRange == mainType+"/*":
+			rangeSpecificity = specificitySubtype
+		case mediaRange == "*/*":
+			rangeSpecificity = specificityAny
+		default:
+			continue
+		}
+
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		quality = q
+		specificity = rangeSpecificity
+	}
+
+	return quality, specificity
+}
@@ -0,0 +1,47 @@
+package ginhttputil
+
+import "testing"
+
+func TestPreferredMediaType(t *testing.T) {
+	offers := []string{"image/webp", "image/jpeg"}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"browser listing webp", "image/avif,image/webp,image/apng,*/*;q=0.8", "image/webp"},
+		{"original preferred by q-value", "image/webp;q=0.5,image/jpeg", "image/jpeg"},
+		{"tie goes to server order", "image/jpeg,image/webp", "image/webp"},
+		{"webp refused", "image/webp;q=0,*/*", "image/jpeg"},
+		{"nothing acceptable", "text/html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PreferredMediaType(tt.accept, offers); got != tt.want {
+				t.Errorf("PreferredMediaType(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplicitlyAccepts(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"image/webp", true},
+		{"IMAGE/WEBP;q=0.9", true},
+		{"image/webp;q=0", false},
+		{"image/*", false},
+		{"*/*", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ExplicitlyAccepts(tt.accept, "image/webp"); got != tt.want {
+			t.Errorf("ExplicitlyAccepts(%q, image/webp) = %t, want %t", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"path/filepath"
 	"regexp"
@@ -27,6 +29,11 @@ func IsImage(filename string) bool {
 	}
 }
 
+// IsOutputImage also accepts the WebP variants stored next to compressed outputs
+func IsOutputImage(filename string) bool {
+	return filepath.Ext(filename) == ".webp" || IsImage(filename)
+}
+
 // generateUniqueFilename generates a clean, unique filename
 func GenerateUniqueFilename(original string) string {
 	ext := filepath.Ext(original)
@@ -47,3 +54,20 @@ func slugify(name string) string {
 	name = reg.ReplaceAllString(name, "")
 	return name
 }
+
+// GenerateBatchID returns a random ID shared by the jobs of one upload
+func GenerateBatchID() string {
+	return randomHex(16)
+}
+
+// GenerateClaimToken returns a random token identifying one claim of an
+// idempotency key
+func GenerateClaimToken() string {
+	return randomHex(16)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,89 @@
+package dto
+
+import "time"
+
+type ReconcileResponse struct {
+	DryRun            bool              `json:"dry_run"`
+	OrphanUploads     []string          `json:"orphan_uploads"`
+	OrphanOutputs     []string          `json:"orphan_outputs"`
+	UnrecordedOutputs []ReconcileOutput `json:"unrecorded_outputs"`
+	MissingOriginals  []int64           `json:"missing_originals"`
+	MissingOutputs    []int64           `json:"missing_outputs"`
+	Fixed             int               `json:"fixed"`
+}
+
+type ReconcileOutput struct {
+	JobID              int64  `json:"job_id"`
+	CompressedFileName string `json:"compressed_file_name"`
+}
+
+type StatsResponse struct {
+	PublishChannelPool ChannelPoolStats `json:"publish_channel_pool"`
+}
+
+type ChannelPoolStats struct {
+	Size          int     `json:"size"`
+	InUse         int     `json:"in_use"`
+	Idle          int     `json:"idle"`
+	Acquires      int64   `json:"acquires"`
+	Timeouts      int64   `json:"timeouts"`
+	Created       int64   `json:"created"`
+	AverageWaitMs float64 `json:"average_wait_ms"`
+	MaxWaitMs     float64 `json:"max_wait_ms"`
+}
+
+type DeadLetterMessage struct {
+	MessageID   string     `json:"message_id"`
+	JobID       *int64     `json:"job_id"`
+	Reason      string     `json:"reason"`
+	Stage       string     `json:"stage"`
+	Retryable   bool       `json:"retryable"`
+	Attempt     int        `json:"attempt"`
+	FailedAt    *time.Time `json:"failed_at"`
+	FailedBy    string     `json:"failed_by"`
+	Redelivered bool       `json:"redelivered"`
+	ContentType string     `json:"content_type"`
+	Body        string     `json:"body"`
+}
+
+type DeadLetterListResponse struct {
+	Depth    int                 `json:"depth"`
+	Messages []DeadLetterMessage `json:"messages"`
+}
+
+// DeadLetterSelection picks DLQ messages by ID, or every message when All is set
+type DeadLetterSelection struct {
+	MessageIDs []string `json:"message_ids"`
+	All        bool     `json:"all"`
+}
+
+type DeadLetterActionResponse struct {
+	Count    int                   `json:"count"`
+	NotFound []string              `json:"not_found"`
+	Failed   []DeadLetterIDFailure `json:"failed"`
+}
+
+type DeadLetterIDFailure struct {
+	MessageID string `json:"message_id"`
+	Error     string `json:"error"`
+}
+
+type ReapResponse struct {
+	Requeued  []int64 `json:"requeued"`
+	Failed    []int64 `json:"failed"`
+	Cancelled []int64 `json:"cancelled"`
+}
+
+type ScheduleResponse struct {
+	Enqueued []int64 `json:"enqueued"`
+}
+
+// ExpiredLease is a processing job whose worker stopped heartbeating
+type ExpiredLease struct {
+	JobID          int64
+	Attempt        int
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time
+	// CancelRequested jobs are cancelled instead of retried
+	CancelRequested bool
+}
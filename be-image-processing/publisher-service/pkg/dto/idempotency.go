@@ -0,0 +1,16 @@
+package dto
+
+// IdempotentResponse is a response stored under an Idempotency-Key
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyKey is a stored key. Response is nil while the request that
+// claimed it is still in flight.
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string
+	Response    *IdempotentResponse
+}
@@ -1,9 +1,13 @@
 package dto
 
-import "time"
+import (
+	"shared/imaging"
+	"time"
+)
 
 type ImageResponse struct {
-	JobIDs []int64 `json:"imageId"`
+	JobIDs  []int64 `json:"imageId"`
+	BatchID string  `json:"batchId"`
 }
 
 type ImageJob struct {
@@ -16,9 +20,125 @@ type ImageJob struct {
 	ErrorMessage       *string    `json:"error_message"`
 	CreatedAt          *time.Time `json:"created_at"`
 	UpdatedAt          *time.Time `json:"updated_at"`
+	CompletedAt        *time.Time `json:"completed_at"`
+	OriginalPurgedAt   *time.Time `json:"original_purged_at"`
+	CompressedPurgedAt *time.Time `json:"compressed_purged_at"`
+	OriginalExpired    bool       `json:"original_expired"`
+	CompressedExpired  bool       `json:"compressed_expired"`
+	Attempt            int        `json:"attempt"`
+	NextRetryAt        *time.Time `json:"next_retry_at"`
+	CancelRequestedAt  *time.Time `json:"cancel_requested_at"`
+	BatchID            *string    `json:"batch_id"`
+	Priority           string     `json:"priority"`
+	ProcessAfter       *time.Time `json:"process_after"`
+	Revision           int        `json:"revision"`
+	// ProcessingOptions are the options the current revision is produced with
+	ProcessingOptions *imaging.Options `json:"processing_options"`
+	// PreviousCompressedFileName is the output a completed reprocess replaced,
+	// kept until the sweep removes it
+	PreviousCompressedFileName *string `json:"previous_compressed_file_name"`
+	// PendingRevision is the revision a reprocess is producing; the current
+	// output is served until it completes
+	PendingRevision *int `json:"pending_revision"`
+	// RevisionError is why the last attempt at a revision failed, or why it was given up
+	RevisionError *string `json:"revision_error"`
+}
+
+// JobFilter selects the jobs a bulk operation applies to. IDs and the other
+// criteria are combined, so IDs outside the criteria are not selected.
+type JobFilter struct {
+	IDs           []int64    `form:"id" json:"ids"`
+	Status        string     `form:"status" json:"status"`
+	ErrorContains string     `form:"error_contains" json:"error_contains"`
+	BatchID       string     `form:"batch_id" json:"batch_id"`
+	Priority      string     `form:"priority" json:"priority"`
+	CreatedAfter  *time.Time `form:"created_after" json:"created_after"`
+	CreatedBefore *time.Time `form:"created_before" json:"created_before"`
+	Limit         int        `form:"limit" json:"limit"`
+}
+
+// BulkJobResult is the outcome of a bulk operation for one job
+type BulkJobResult struct {
+	ID      int64  `json:"id"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkRetryRequest selects the jobs to requeue; DryRun only reports what
+// would be requeued
+type BulkRetryRequest struct {
+	JobFilter
+	DryRun bool `json:"dry_run"`
+}
+
+// ReprocessRequest holds the options a new output revision is produced with
+type ReprocessRequest struct {
+	Options imaging.Options `json:"options"`
+}
+
+// BulkReprocessRequest selects the completed jobs to reprocess; DryRun only
+// reports what would be reprocessed
+type BulkReprocessRequest struct {
+	JobFilter
+	Options imaging.Options `json:"options"`
+	DryRun  bool            `json:"dry_run"`
+}
+
+type ReprocessJobResponse struct {
+	ID       int64 `json:"id"`
+	Revision int   `json:"revision"`
+}
+
+type BulkJobResponse struct {
+	DryRun  bool            `json:"dry_run,omitempty"`
+	Matched int             `json:"matched"`
+	Count   int             `json:"count"`
+	Results []BulkJobResult `json:"results"`
+}
+
+type CancelJobResponse struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
 }
 
 type CompressedImageResponse struct {
 	Filename string `json:"filename"`
 	Path     string `json:"path"`
 }
+
+type RetentionSweepResponse struct {
+	OriginalsPurged  int `json:"originals_purged"`
+	OutputsPurged    int `json:"outputs_purged"`
+	SupersededPurged int `json:"superseded_purged"`
+}
+
+type RenderOptions struct {
+	Width   uint   `form:"w"`
+	Height  uint   `form:"h"`
+	Fit     string `form:"fit"`
+	Format  string `form:"fmt"`
+	Quality int    `form:"q"`
+}
+
+type JobAttempt struct {
+	ID         int64      `json:"id"`
+	JobID      int64      `json:"job_id"`
+	Attempt    int        `json:"attempt"`
+	WorkerID   string     `json:"worker_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Outcome    *string    `json:"outcome"`
+	Stage      *string    `json:"stage"`
+	Error      *string    `json:"error"`
+	DurationMs *int64     `json:"duration_ms"`
+}
+
+type JobEvent struct {
+	ID         int64     `json:"id"`
+	JobID      int64     `json:"job_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Reason     *string   `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
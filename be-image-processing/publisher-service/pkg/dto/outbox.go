@@ -0,0 +1,11 @@
+package dto
+
+type OutboxMessage struct {
+	ID       int64  `json:"id"`
+	JobID    int64  `json:"job_id"`
+	Filename string `json:"filename"`
+	Attempts int    `json:"attempts"`
+	// JobAttempt is the processing attempt the message is published for
+	JobAttempt int    `json:"job_attempt"`
+	Priority   string `json:"priority"`
+}
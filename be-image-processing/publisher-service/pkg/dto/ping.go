@@ -4,3 +4,9 @@ type PublicPingResponse struct {
 	Message   string `json:"message"`
 	Timestamp int64  `json:"timestamp"`
 }
+
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	RabbitMQ string `json:"rabbitmq"`
+}
@@ -0,0 +1,8 @@
+module shared
+
+go 1.24
+
+require (
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/rabbitmq/amqp091-go v1.10.0
+)
@@ -0,0 +1,173 @@
+// Package imaging holds the decode, resize and encode steps shared by the
+// subscriber's compression worker and the publisher's render endpoint.
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+
+	DefaultQuality = 70
+)
+
+// Fit controls how an image is scaled into the requested box
+type Fit string
+
+const (
+	// FitContain scales the image to fit inside the box, keeping its aspect ratio
+	FitContain = Fit("contain")
+	// FitCover scales the image to cover the box and crops the overflow
+	FitCover = Fit("cover")
+	// FitFill stretches the image to exactly the box
+	FitFill = Fit("fill")
+)
+
+// Options describes a transformation. A zero Width or Height is derived from
+// the other one using the source aspect ratio. An empty Format keeps the
+// source format. Options are stored as JSON on jobs that are reprocessed.
+type Options struct {
+	Width   uint   `json:"width,omitempty"`
+	Height  uint   `json:"height,omitempty"`
+	Fit     Fit    `json:"fit,omitempty"`
+	Format  string `json:"format,omitempty"`
+	Quality int    `json:"quality,omitempty"`
+}
+
+// IsValidFit reports whether fit is a known fit mode
+func IsValidFit(fit Fit) bool {
+	switch fit {
+	case FitContain, FitCover, FitFill:
+		return true
+	default:
+		return false
+	}
+}
+
+// NormalizeFormat maps format names and aliases to FormatJPEG or FormatPNG
+func NormalizeFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "jpeg", "jpg":
+		return FormatJPEG, nil
+	case "png":
+		return FormatPNG, nil
+	default:
+		return "", fmt.Errorf("unsupported image format: %s", format)
+	}
+}
+
+// FormatFromFilename returns the format implied by a file extension
+func FormatFromFilename(filename string) (string, error) {
+	return NormalizeFormat(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// Extension returns the file extension, including the dot, for a format
+func Extension(format string) string {
+	if format == FormatPNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Decode reads an image and returns it with its normalized format
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	format, err = NormalizeFormat(format)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, format, nil
+}
+
+// Resize scales img into a width x height box according to fit
+func Resize(img image.Image, width, height uint, fit Fit) image.Image {
+	if width == 0 && height == 0 {
+		return img
+	}
+
+	if width == 0 || height == 0 {
+		return resize.Resize(width, height, img, resize.Lanczos3)
+	}
+
+	switch fit {
+	case FitFill:
+		return resize.Resize(width, height, img, resize.Lanczos3)
+	case FitCover:
+		return cover(img, width, height)
+	default:
+		return resize.Thumbnail(width, height, img, resize.Lanczos3)
+	}
+}
+
+// cover scales img so it fully covers the box, then crops the center
+func cover(img image.Image, width, height uint) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := float64(bounds.Dx()), float64(bounds.Dy())
+
+	scale := max(float64(width)/srcW, float64(height)/srcH)
+	scaled := resize.Resize(uint(srcW*scale+0.5), uint(srcH*scale+0.5), img, resize.Lanczos3)
+
+	sb := scaled.Bounds()
+	offsetX := sb.Min.X + (sb.Dx()-int(width))/2
+	offsetY := sb.Min.Y + (sb.Dy()-int(height))/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	draw.Draw(dst, dst.Bounds(), scaled, image.Pt(offsetX, offsetY), draw.Src)
+	return dst
+}
+
+// Encode writes img in the given format. Quality only applies to JPEG.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if quality <= 0 {
+		quality = DefaultQuality
+	}
+
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+}
+
+// Transform decodes r, applies opts and encodes the result to w. It returns
+// the format that was written.
+func Transform(r io.Reader, w io.Writer, opts Options) (string, error) {
+	img, format, err := Decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Format != "" {
+		format, err = NormalizeFormat(opts.Format)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	resized := Resize(img, opts.Width, opts.Height, opts.Fit)
+
+	if err := Encode(w, resized, format, opts.Quality); err != nil {
+		return "", err
+	}
+
+	return format, nil
+}
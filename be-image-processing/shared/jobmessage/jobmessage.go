@@ -0,0 +1,98 @@
+// Package jobmessage is the contract for the messages the publisher sends to
+// the image_jobs queue and the subscriber consumes. Both services encode and
+// decode job messages only through this package, so they cannot drift apart.
+//
+// Every message carries the schema version it was written with, in the body
+// and in the x-schema-version header. Version 1 is the unversioned message
+// published before the schema was versioned; it has no schema_version field.
+// A change that older subscribers cannot read gets a new version, and Decode
+// keeps reading the older ones until no queue can hold them any more.
+package jobmessage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+)
+
+const (
+	// SchemaVersion is the version Encode writes
+	SchemaVersion = 2
+
+	// ContentType is the content type of a job message
+	ContentType = "application/json"
+
+	// HeaderSchemaVersion carries the schema version of the body, so tools
+	// can tell versions apart without decoding it
+	HeaderSchemaVersion = "x-schema-version"
+)
+
+var (
+	// ErrUnsupportedVersion means the message was written with a newer schema
+	// than this build knows, e.g. by a publisher deployed before the subscriber
+	ErrUnsupportedVersion = errors.New("unsupported job message schema version")
+	// ErrUnsupportedContentType means the message is not a JSON job message
+	ErrUnsupportedContentType = errors.New("unsupported job message content type")
+	// ErrInvalidMessage means the message does not identify a job
+	ErrInvalidMessage = errors.New("invalid job message")
+)
+
+// Message asks for job ID to be processed. Filename is informational; the
+// subscriber reads the job's current state from the database.
+type Message struct {
+	SchemaVersion int    `json:"schema_version"`
+	ID            int64  `json:"id"`
+	Filename      string `json:"filename,omitempty"`
+}
+
+// New returns a message for job id at the current schema version
+func New(id int64, filename string) Message {
+	return Message{SchemaVersion: SchemaVersion, ID: id, Filename: filename}
+}
+
+// Encode returns the body of message
+func Encode(message Message) ([]byte, error) {
+	if message.SchemaVersion == 0 {
+		message.SchemaVersion = SchemaVersion
+	}
+	if message.ID <= 0 {
+		return nil, fmt.Errorf("%w: job ID must be positive, found: %d", ErrInvalidMessage, message.ID)
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("encode job message: %w", err)
+	}
+	return body, nil
+}
+
+// Decode reads a message of any supported schema version. An empty content
+// type is accepted for messages published before it was set, and unknown
+// fields are ignored so additive changes do not need a new version.
+func Decode(contentType string, body []byte) (Message, error) {
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != ContentType {
+			return Message{}, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+		}
+	}
+
+	var message Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	if message.SchemaVersion == 0 {
+		message.SchemaVersion = 1
+	}
+	if message.SchemaVersion < 0 || message.SchemaVersion > SchemaVersion {
+		return Message{}, fmt.Errorf("%w: %d, this build reads up to %d", ErrUnsupportedVersion, message.SchemaVersion, SchemaVersion)
+	}
+
+	if message.ID <= 0 {
+		return Message{}, fmt.Errorf("%w: job ID must be positive, found: %d", ErrInvalidMessage, message.ID)
+	}
+
+	return message, nil
+}
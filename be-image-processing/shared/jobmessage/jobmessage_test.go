@@ -0,0 +1,99 @@
+package jobmessage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The files in testdata are bodies publishers have sent, per schema version.
+// A changed wire format fails these tests until it gets a new version and
+// fixture, and Decode has to keep reading every fixture listed below.
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return bytes.TrimSpace(body)
+}
+
+func TestEncodeMatchesCurrentFixture(t *testing.T) {
+	body, err := Encode(New(42, "1700000000000000000_cat.jpg"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	want := readFixture(t, fmt.Sprintf("v%d.json", SchemaVersion))
+	if !bytes.Equal(body, want) {
+		t.Errorf("Encode wrote %s, want %s", body, want)
+	}
+}
+
+func TestDecodeSupportedVersions(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		contentType string
+		want        Message
+	}{
+		{"v1.json", "", Message{SchemaVersion: 1, ID: 42, Filename: "1700000000000000000_cat.jpg"}},
+		{"v1_id_only.json", ContentType, Message{SchemaVersion: 1, ID: 42}},
+		{"v2.json", ContentType, Message{SchemaVersion: 2, ID: 42, Filename: "1700000000000000000_cat.jpg"}},
+		{"v2.json", ContentType + "; charset=utf-8", Message{SchemaVersion: 2, ID: 42, Filename: "1700000000000000000_cat.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := Decode(tt.contentType, readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decode = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        error
+	}{
+		{"newer version", ContentType, fmt.Sprintf(`{"schema_version":%d,"id":42}`, SchemaVersion+1), ErrUnsupportedVersion},
+		{"other content type", "text/plain", `{"id":42}`, ErrUnsupportedContentType},
+		{"missing job ID", ContentType, `{"schema_version":2}`, ErrInvalidMessage},
+		{"malformed body", ContentType, `{"id":`, ErrInvalidMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.contentType, []byte(tt.body))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrips(t *testing.T) {
+	message := New(7, "image.png")
+
+	body, err := Encode(message)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got, err := Decode(ContentType, body)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got != message {
+		t.Errorf("round trip = %+v, want %+v", got, message)
+	}
+}
@@ -0,0 +1,268 @@
+// Package jobstate is the only place job statuses change. Every change is a
+// conditional UPDATE that only applies when the current status may move to
+// the new one, and writes an image_job_events row in the same statement, so
+// concurrent writers cannot move a job backwards and every change is audited.
+package jobstate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Status is the status column of image_jobs
+type Status string
+
+const (
+	Pending    = Status("pending")
+	Processing = Status("processing")
+	Retrying   = Status("retrying")
+	Completed  = Status("completed")
+	Failed     = Status("failed")
+	Cancelled  = Status("cancelled")
+	Scheduled  = Status("scheduled")
+)
+
+var (
+	// ErrIllegalTransition means the job is in a status that cannot move to the requested one
+	ErrIllegalTransition = errors.New("illegal job status transition")
+	// ErrJobNotFound means no job has the given ID
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// transitions lists, for each target status, the statuses a job may be in
+// to move there
+var transitions = map[Status][]Status{
+	// Requeued by a retry or DLQ replay, or handed back by a worker that
+	// was shut down mid-job. A bulk requeue may also re-enqueue a cancelled
+	// job. A scheduled job becomes pending when it is due.
+	Pending: {Failed, Processing, Cancelled, Scheduled},
+	// Picked up by a worker; processing again means a redelivery took the
+	// job over after the previous worker's lease expired, which only an
+	// Unleased change may do
+	Processing: {Pending, Retrying, Processing},
+	Retrying:   {Processing},
+	// Finished by a worker, or an output of a job still being processed
+	// found by the reconciler
+	Completed: {Processing, Pending, Retrying},
+	// Any unfinished job can fail
+	Failed: {Pending, Processing, Retrying, Scheduled},
+	// Cancelled directly while waiting, or by the worker that noticed the
+	// cancel request of a processing job
+	Cancelled: {Pending, Retrying, Processing, Scheduled},
+	// Jobs are only created scheduled, never moved there
+	Scheduled: {},
+}
+
+// IsValid reports whether status is a known status
+func IsValid(status Status) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanTransition reports whether a job in from may move to to
+func CanTransition(from, to Status) bool {
+	for _, allowed := range transitions[to] {
+		if allowed == from {
+			return true
+		}
+	}
+	return false
+}
+
+// Querier is satisfied by *sql.DB and *sql.Tx, so a transition can join the
+// caller's transaction
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Field is an extra column written together with the status
+type Field struct {
+	column string
+	value  any
+	expr   string
+}
+
+// Set writes value to column
+func Set(column string, value any) Field {
+	return Field{column: column, value: value}
+}
+
+// SetExpr writes a SQL expression such as NOW() to column
+func SetExpr(column, expr string) Field {
+	return Field{column: column, expr: expr}
+}
+
+// Change describes one transition and who made it, for the audit trail.
+// From narrows the statuses the job may be in to the ones the caller expects;
+// it never allows a transition the state machine does not. When LeaseOwner is
+// set the change only applies while that worker holds the job's lease; when
+// Unleased is set it only applies while nobody holds an unexpired lease, so a
+// duplicate delivery cannot take a job over from the worker processing it.
+type Change struct {
+	To         Status
+	From       []Status
+	LeaseOwner string
+	Unleased   bool
+	Actor      string
+	Reason     string
+	Fields     []Field
+}
+
+// IllegalTransitionError is returned when the job's current status does not
+// allow the change. It matches ErrIllegalTransition with errors.Is.
+type IllegalTransitionError struct {
+	ID   int64
+	From Status
+	To   Status
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("job %d cannot move from %s to %s", e.ID, e.From, e.To)
+}
+
+func (e *IllegalTransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Transition applies change to job id and returns the status it moved from
+func Transition(q Querier, id int64, change Change) (Status, error) {
+	allowed, err := allowedFrom(change)
+	if err != nil {
+		return "", err
+	}
+
+	// $1 id, $2 target status, $3 actor, $4 reason, then allowed statuses
+	// and field values
+	args := []any{id, string(change.To), change.Actor, change.Reason}
+
+	placeholders := make([]string, len(allowed))
+	for i, status := range allowed {
+		args = append(args, string(status))
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	assignments := []string{"status = $2", "updated_at = NOW()"}
+	// Only a processing job is leased; every other status releases the lease
+	if change.To != Processing {
+		assignments = append(assignments, "lease_owner = NULL", "lease_expires_at = NULL")
+	}
+	for _, field := range change.Fields {
+		if field.expr != "" {
+			assignments = append(assignments, fmt.Sprintf("%s = %s", field.column, field.expr))
+			continue
+		}
+		args = append(args, field.value)
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", field.column, len(args)))
+	}
+
+	leaseCondition := ""
+	if change.LeaseOwner != "" {
+		args = append(args, change.LeaseOwner)
+		leaseCondition = fmt.Sprintf(" AND locked.lease_owner = $%d", len(args))
+	}
+	if change.Unleased {
+		leaseCondition += " AND NOT locked.lease_held"
+	}
+
+	query := `
+		WITH locked AS (
+			SELECT id, status, lease_owner, COALESCE(lease_expires_at > NOW(), FALSE) AS lease_held
+			FROM image_jobs WHERE id = $1 FOR UPDATE
+		), moved AS (
+			UPDATE image_jobs j
+			SET ` + strings.Join(assignments, ", ") + `
+			FROM locked
+			WHERE j.id = locked.id AND locked.status IN (` + strings.Join(placeholders, ", ") + `)` + leaseCondition + `
+			RETURNING locked.status AS from_status
+		), audited AS (
+			INSERT INTO image_job_events (job_id, from_status, to_status, actor, reason)
+			SELECT $1, from_status, $2, $3, NULLIF($4, '') FROM moved
+		)
+		SELECT (SELECT status FROM locked), (SELECT lease_owner FROM locked), (SELECT lease_held FROM locked), (SELECT from_status FROM moved)
+	`
+
+	var row transitionRow
+	if err := q.QueryRow(query, args...).Scan(&row.locked, &row.lockedOwner, &row.leaseHeld, &row.moved); err != nil {
+		return "", fmt.Errorf("transition job %d to %s: %w", id, change.To, err)
+	}
+
+	return row.result(id, change, allowed)
+}
+
+// allowedFrom returns the statuses change may move a job from: the ones the
+// state machine allows, narrowed to change.From when it is set. Only an
+// Unleased change may take over a processing job.
+func allowedFrom(change Change) ([]Status, error) {
+	if !IsValid(change.To) {
+		return nil, fmt.Errorf("unknown job status: %s", change.To)
+	}
+
+	from := transitions[change.To]
+	if len(change.From) > 0 {
+		from = change.From
+	}
+
+	var allowed []Status
+	for _, status := range from {
+		if !CanTransition(status, change.To) {
+			continue
+		}
+		if status == Processing && change.To == Processing && !change.Unleased {
+			continue
+		}
+		allowed = append(allowed, status)
+	}
+
+	if len(allowed) == 0 && len(change.From) > 0 {
+		return nil, fmt.Errorf("no status in %v may move to %s", change.From, change.To)
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("no status may move to %s", change.To)
+	}
+	return allowed, nil
+}
+
+// transitionRow is what the transition query reports about the job: its
+// status and lease when it was locked, and the status it moved from if the
+// update applied
+type transitionRow struct {
+	locked, lockedOwner, moved sql.NullString
+	leaseHeld                  sql.NullBool
+}
+
+// result turns the row into the status the job moved from, or the error
+// explaining why it did not move
+func (row transitionRow) result(id int64, change Change, allowed []Status) (Status, error) {
+	if !row.locked.Valid {
+		return "", fmt.Errorf("transition job %d to %s: %w", id, change.To, ErrJobNotFound)
+	}
+	if !row.moved.Valid && change.LeaseOwner != "" && row.lockedOwner.String != change.LeaseOwner {
+		return Status(row.locked.String), fmt.Errorf("transition job %d to %s: %w", id, change.To, ErrLeaseLost)
+	}
+	if !row.moved.Valid && change.Unleased && row.leaseHeld.Bool && slices.Contains(allowed, Status(row.locked.String)) {
+		return Status(row.locked.String), fmt.Errorf("transition job %d to %s: %w", id, change.To, ErrLeaseHeld)
+	}
+	if !row.moved.Valid {
+		return Status(row.locked.String), &IllegalTransitionError{ID: id, From: Status(row.locked.String), To: change.To}
+	}
+
+	return Status(row.moved.String), nil
+}
+
+// RecordCreated audits the creation of a job inserted with status
+func RecordCreated(q Querier, id int64, status Status, actor, reason string) error {
+	query := `
+		INSERT INTO image_job_events (job_id, from_status, to_status, actor, reason)
+		VALUES ($1, NULL, $2, $3, NULLIF($4, ''))
+		RETURNING id
+	`
+
+	var eventID int64
+	if err := q.QueryRow(query, id, string(status), actor, reason).Scan(&eventID); err != nil {
+		return fmt.Errorf("record creation of job %d: %w", id, err)
+	}
+	return nil
+}
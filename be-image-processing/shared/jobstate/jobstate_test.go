@@ -0,0 +1,151 @@
+package jobstate
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+var allStatuses = []Status{Pending, Processing, Retrying, Completed, Failed, Cancelled, Scheduled}
+
+// The edges below are the ones some caller makes. A new edge has to be added
+// here as well, so widening the state machine is a deliberate change.
+func TestCanTransition(t *testing.T) {
+	want := map[Status][]Status{
+		Pending:    {Failed, Processing, Cancelled, Scheduled},
+		Processing: {Pending, Retrying, Processing},
+		Retrying:   {Processing},
+		Completed:  {Processing, Pending, Retrying},
+		Failed:     {Pending, Processing, Retrying, Scheduled},
+		Cancelled:  {Pending, Retrying, Processing, Scheduled},
+		Scheduled:  {},
+	}
+
+	for _, to := range allStatuses {
+		for _, from := range allStatuses {
+			if got := CanTransition(from, to); got != slices.Contains(want[to], from) {
+				t.Errorf("CanTransition(%s, %s) = %t, want %t", from, to, got, !got)
+			}
+		}
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	for _, status := range allStatuses {
+		if !IsValid(status) {
+			t.Errorf("IsValid(%s) = false, want true", status)
+		}
+	}
+	for _, status := range []Status{"", "complete", "PENDING"} {
+		if IsValid(status) {
+			t.Errorf("IsValid(%q) = true, want false", status)
+		}
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  Change
+		want    []Status
+		wantErr bool
+	}{
+		{"all allowed", Change{To: Failed}, []Status{Pending, Processing, Retrying, Scheduled}, false},
+		{"narrowed by from", Change{To: Cancelled, From: []Status{Pending, Retrying, Scheduled}}, []Status{Pending, Retrying, Scheduled}, false},
+		{"illegal from dropped", Change{To: Pending, From: []Status{Failed, Retrying}}, []Status{Failed}, false},
+		{"processing takeover needs unleased", Change{To: Processing}, []Status{Pending, Retrying}, false},
+		{"unleased takes over processing", Change{To: Processing, Unleased: true}, []Status{Pending, Retrying, Processing}, false},
+		{"no legal from", Change{To: Retrying, From: []Status{Pending}}, nil, true},
+		{"nothing moves to scheduled", Change{To: Scheduled}, nil, true},
+		{"unknown status", Change{To: "complete"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allowedFrom(tt.change)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allowedFrom error = %v, want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("allowedFrom = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitionResult(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	held := sql.NullBool{Bool: true, Valid: true}
+
+	tests := []struct {
+		name     string
+		change   Change
+		row      transitionRow
+		want     Status
+		wantErrs []error
+	}{
+		{
+			name:   "moved",
+			change: Change{To: Completed, LeaseOwner: "worker-1"},
+			row:    transitionRow{locked: str("processing"), lockedOwner: str("worker-1"), moved: str("processing")},
+			want:   Processing,
+		},
+		{
+			name:     "job not found",
+			change:   Change{To: Failed},
+			row:      transitionRow{},
+			wantErrs: []error{ErrJobNotFound},
+		},
+		{
+			name:     "lease lost to another owner",
+			change:   Change{To: Completed, LeaseOwner: "worker-1"},
+			row:      transitionRow{locked: str("retrying"), lockedOwner: str("")},
+			want:     Retrying,
+			wantErrs: []error{ErrLeaseLost},
+		},
+		{
+			name:     "lease held by another worker",
+			change:   Change{To: Processing, Unleased: true},
+			row:      transitionRow{locked: str("processing"), lockedOwner: str("worker-2"), leaseHeld: held},
+			want:     Processing,
+			wantErrs: []error{ErrLeaseHeld},
+		},
+		{
+			name:     "held lease on a status that may not move is illegal",
+			change:   Change{To: Processing, Unleased: true},
+			row:      transitionRow{locked: str("completed"), leaseHeld: held},
+			want:     Completed,
+			wantErrs: []error{ErrIllegalTransition},
+		},
+		{
+			name:     "illegal transition",
+			change:   Change{To: Cancelled, From: []Status{Pending}},
+			row:      transitionRow{locked: str("completed")},
+			want:     Completed,
+			wantErrs: []error{ErrIllegalTransition},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := allowedFrom(tt.change)
+			if err != nil {
+				t.Fatalf("allowedFrom: %v", err)
+			}
+
+			got, err := tt.row.result(42, tt.change, allowed)
+			if got != tt.want {
+				t.Errorf("result status = %q, want %q", got, tt.want)
+			}
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Errorf("result error = %v, want nil", err)
+			}
+			for _, wantErr := range tt.wantErrs {
+				if !errors.Is(err, wantErr) {
+					t.Errorf("result error = %v, want %v", err, wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package jobstate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrLeaseLost means the worker no longer holds the job's lease, usually
+	// because the reaper found it expired and handed the job to someone else
+	ErrLeaseLost = errors.New("job lease lost")
+	// ErrCancelRequested means cancellation of the processing job was requested
+	ErrCancelRequested = errors.New("job cancellation requested")
+	// ErrLeaseHeld means another worker holds an unexpired lease on the job
+	ErrLeaseHeld = errors.New("job lease held by another worker")
+)
+
+// Lease returns the fields that give owner the lease on a job moving to
+// processing for duration
+func Lease(owner string, duration time.Duration) []Field {
+	return []Field{
+		Set("lease_owner", owner),
+		SetExpr("lease_expires_at", leaseExpiry(duration)),
+	}
+}
+
+// Heartbeat extends the lease owner holds on a processing job, or on a
+// completed job whose pending revision owner is producing. It returns
+// ErrLeaseLost when the job is no longer leased to that owner, and
+// ErrCancelRequested when someone asked for the job to be cancelled.
+func Heartbeat(q Querier, id int64, owner string, duration time.Duration) error {
+	query := `
+		UPDATE image_jobs
+		SET lease_expires_at = ` + leaseExpiry(duration) + `
+		WHERE id = $1 AND status IN ($2, $3) AND lease_owner = $4
+		RETURNING cancel_requested_at IS NOT NULL
+	`
+
+	var cancelRequested bool
+	err := q.QueryRow(query, id, string(Processing), string(Completed), owner).Scan(&cancelRequested)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("heartbeat job %d: %w", id, ErrLeaseLost)
+	}
+	if err != nil {
+		return fmt.Errorf("heartbeat job %d: %w", id, err)
+	}
+	if cancelRequested {
+		return fmt.Errorf("heartbeat job %d: %w", id, ErrCancelRequested)
+	}
+	return nil
+}
+
+// RequestCancel flags a processing job, or a completed job whose pending
+// revision a worker holds the lease on, for cancellation. It returns
+// ErrIllegalTransition when no worker is producing an output of the job.
+func RequestCancel(q Querier, id int64) error {
+	query := `
+		UPDATE image_jobs
+		SET cancel_requested_at = COALESCE(cancel_requested_at, NOW())
+		WHERE id = $1
+		  AND (status = $2
+		       OR (status = $3 AND pending_revision IS NOT NULL AND lease_expires_at > NOW()))
+		RETURNING id
+	`
+
+	var flagged int64
+	err := q.QueryRow(query, id, string(Processing), string(Completed)).Scan(&flagged)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("request cancel of job %d: %w", id, ErrIllegalTransition)
+	}
+	if err != nil {
+		return fmt.Errorf("request cancel of job %d: %w", id, err)
+	}
+	return nil
+}
+
+func leaseExpiry(duration time.Duration) string {
+	return fmt.Sprintf("NOW() + INTERVAL '%d milliseconds'", duration.Milliseconds())
+}
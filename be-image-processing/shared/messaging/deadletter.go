@@ -0,0 +1,11 @@
+package messaging
+
+// Headers a worker adds when it routes a message to the failed_jobs queue, so
+// the message explains itself without looking up the job row
+const (
+	HeaderFailureReason = "x-failure-reason"
+	HeaderFailureStage  = "x-failure-stage"
+	HeaderFailedAt      = "x-failed-at"
+	HeaderFailedBy      = "x-failed-by"
+	HeaderRetryable     = "x-failure-retryable"
+)
@@ -0,0 +1,42 @@
+package messaging
+
+import "fmt"
+
+// Priority is how urgently a job should be processed. QueueImageJobs is a
+// priority queue, so high priority jobs overtake queued backfills.
+type Priority string
+
+const (
+	PriorityLow    = Priority("low")
+	PriorityNormal = Priority("normal")
+	PriorityHigh   = Priority("high")
+)
+
+// MaxPriority is the x-max-priority of QueueImageJobs. RabbitMQ keeps a
+// sub-queue per level, so only as many levels as priorities are declared.
+const MaxPriority = 3
+
+// ParsePriority validates value, treating an empty value as PriorityNormal
+func ParsePriority(value string) (Priority, error) {
+	switch priority := Priority(value); priority {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh:
+		return priority, nil
+	default:
+		return "", fmt.Errorf("invalid priority %q, must be one of: low, normal, high", value)
+	}
+}
+
+// Level returns the AMQP message priority for p. Messages published before
+// priorities existed have priority 0 and are consumed after low ones.
+func (p Priority) Level() uint8 {
+	switch p {
+	case PriorityHigh:
+		return 3
+	case PriorityLow:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultRetryDelays is how long a job waits before each retry, "|"
+// separated. A job gets one attempt plus one retry per delay.
+const DefaultRetryDelays = "5s|30s|5m|30m"
+
+// ParseRetryDelays parses a "|" separated list of positive durations
+func ParseRetryDelays(value string) ([]time.Duration, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var delays []time.Duration
+	for _, item := range strings.Split(value, "|") {
+		delay, err := time.ParseDuration(strings.TrimSpace(item))
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("retry delays must be a list of positive durations, found: %s", value)
+		}
+		delays = append(delays, delay)
+	}
+	return delays, nil
+}
+
+// HeaderAttempt carries the attempt number a message is delivered for. The
+// first delivery has no header and counts as attempt 1.
+const HeaderAttempt = "x-attempt"
+
+// RetryTierQueue returns the name of the queue that holds messages for delay
+// before sending them back to QueueImageJobs
+func RetryTierQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s_%dms", QueueRetry, delay.Milliseconds())
+}
+
+// RetryTierRoutingKey returns the routing key on the retry exchange that
+// reaches the tier queue for delay
+func RetryTierRoutingKey(delay time.Duration) string {
+	return fmt.Sprintf("%s.%dms", RoutingKeyRetry, delay.Milliseconds())
+}
+
+// DeclareRetryTiers declares one delay queue per retry tier. Messages wait in
+// a tier queue until its TTL expires and are then dead-lettered back to
+// QueueImageJobs. Each delay gets its own queue because a queue only expires
+// messages at its head, so mixing delays in one queue would hold short ones
+// behind long ones.
+func DeclareRetryTiers(ch *amqp.Channel, delays []time.Duration) error {
+	for _, delay := range delays {
+		queue := RetryTierQueue(delay)
+
+		_, err := ch.QueueDeclare(
+			queue,
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",             // default exchange
+				"x-dead-letter-routing-key": QueueImageJobs, // back to main
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("declare %s: %w", queue, err)
+		}
+
+		if err := ch.QueueBind(queue, RetryTierRoutingKey(delay), ExchangeRetry, false, nil); err != nil {
+			return fmt.Errorf("bind %s: %w", queue, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package messaging holds the RabbitMQ topology both services declare, so a
+// broker restart can be recovered from whichever service reconnects first.
+package messaging
+
+import (
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	ExchangeDeadLetter = "dead_letter_exchange"
+	ExchangeRetry      = "retry_exchange"
+
+	QueueImageJobs  = "image_jobs.priority"
+	QueueRetry      = "retry_queue.priority"
+	QueueFailedJobs = "failed_jobs"
+
+	RoutingKeyRetry      = "retry.priority"
+	RoutingKeyFailedJobs = "failed_jobs"
+)
+
+// Queues of the topology before priorities existed. RabbitMQ cannot add
+// x-max-priority to a declared queue, so the priority queue and every retry
+// queue that dead-letters into it were declared under new names next to them.
+//
+// Migration: nothing publishes to the legacy queues any more, but messages
+// already in them keep flowing, each retry tier into the legacy image_jobs
+// queue, which the subscriber consumes alongside QueueImageJobs while it
+// exists. Once the legacy image_jobs, retry_queue and retry_queue_<delay>ms
+// queues are all empty, which takes at most the longest retry delay after
+// every instance was upgraded, delete them with
+// rabbitmqctl delete_queue <name> --if-empty.
+const QueueLegacyImageJobs = "image_jobs"
+
+// DeclareTopology declares the exchanges and queues of the job pipeline on a
+// channel of its own. Declaring is idempotent as long as the arguments do not
+// change; the legacy queues are left alone.
+func DeclareTopology(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	// Dead Letter Exchange
+	if err := ch.ExchangeDeclare(ExchangeDeadLetter, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare DLX: %w", err)
+	}
+
+	// Retry Exchange
+	if err := ch.ExchangeDeclare(ExchangeRetry, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare retry exchange: %w", err)
+	}
+
+	// Retry Queue
+	_, err = ch.QueueDeclare(
+		QueueRetry,
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{
+			"x-message-ttl":             int32(5000),    // 5s
+			"x-dead-letter-exchange":    "",             // default exchange
+			"x-dead-letter-routing-key": QueueImageJobs, // back to main
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("declare %s: %w", QueueRetry, err)
+	}
+	if err := ch.QueueBind(QueueRetry, RoutingKeyRetry, ExchangeRetry, false, nil); err != nil {
+		return fmt.Errorf("bind %s: %w", QueueRetry, err)
+	}
+
+	// Failed Jobs Queue
+	_, err = ch.QueueDeclare(
+		QueueFailedJobs,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("declare failed_jobs queue: %w", err)
+	}
+	if err := ch.QueueBind(QueueFailedJobs, RoutingKeyFailedJobs, ExchangeDeadLetter, false, nil); err != nil {
+		return fmt.Errorf("bind failed_jobs queue: %w", err)
+	}
+
+	// Main Image Jobs Queue
+	_, err = ch.QueueDeclare(
+		QueueImageJobs,
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{
+			"x-dead-letter-exchange":    ExchangeRetry,
+			"x-dead-letter-routing-key": RoutingKeyRetry,
+			"x-max-priority":            int32(MaxPriority),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("declare %s: %w", QueueImageJobs, err)
+	}
+
+	return nil
+}
+
+// LegacyImageJobsExists reports whether the image_jobs queue declared before
+// priorities still exists, and how many messages it holds, so the caller can
+// keep consuming it until it is deleted
+func LegacyImageJobsExists(conn *amqp.Connection) (exists bool, messages int, err error) {
+	// A passive declare of a missing queue closes its channel
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, 0, fmt.Errorf("open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclarePassive(QueueLegacyImageJobs, true, false, false, false, nil)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("inspect %s: %w", QueueLegacyImageJobs, err)
+	}
+	return true, queue.Messages, nil
+}
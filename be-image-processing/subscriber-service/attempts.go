@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Outcomes recorded for an attempt in image_job_attempts
+const (
+	outcomeSucceeded = "succeeded"
+	outcomeRetrying  = "retrying"
+	outcomeFailed    = "failed"
+	outcomeAborted   = "aborted"
+	outcomeCancelled = "cancelled"
+)
+
+// jobAttempt is one row of image_job_attempts that is being written
+type jobAttempt struct {
+	id      int64
+	started time.Time
+}
+
+// startAttempt records that workerID started attempt of a job. Failing to
+// record history never fails the job, so errors are only logged.
+func startAttempt(db *sql.DB, jobID, attempt int, workerID string) jobAttempt {
+	started := time.Now()
+
+	query := `
+        INSERT INTO image_job_attempts (job_id, attempt, worker_id, started_at)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id
+    `
+	var id int64
+	if err := db.QueryRow(query, jobID, attempt, workerID, started).Scan(&id); err != nil {
+		log.Printf("Failed to record attempt start for job %d: %v", jobID, err)
+	}
+
+	return jobAttempt{id: id, started: started}
+}
+
+// finish records how the attempt ended, the stage it reached and its error
+func (a jobAttempt) finish(db *sql.DB, outcome, stage string, jobErr error) {
+	if a.id == 0 {
+		return
+	}
+
+	var errorMsg *string
+	if jobErr != nil {
+		message := jobErr.Error()
+		errorMsg = &message
+	}
+
+	finished := time.Now()
+	query := `
+        UPDATE image_job_attempts
+        SET finished_at = $2, outcome = $3, stage = $4, error = $5, duration_ms = $6
+        WHERE id = $1
+    `
+	_, err := db.Exec(query, a.id, finished, outcome, stage, errorMsg, finished.Sub(a.started).Milliseconds())
+	if err != nil {
+		log.Printf("Failed to record attempt %d outcome: %v", a.id, err)
+	}
+}
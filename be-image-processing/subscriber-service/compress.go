@@ -1,53 +1,78 @@
 package main
 
 import (
-	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/nfnt/resize"
+	"shared/imaging"
 )
 
-func compressImage(inputPath, outputPath string) (int64, error) {
+// compressImage writes the compressed original to outputPath and returns the
+// resized image it encoded. Without options the image is halved in height and
+// re-encoded in its own format at the default quality.
+func compressImage(inputPath, outputPath string, opts imaging.Options) (image.Image, int64, error) {
 	file, err := os.Open(inputPath)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	defer file.Close()
 
-	img, format, err := image.Decode(file)
+	img, format, err := imaging.Decode(file)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
-	newImg := resize.Resize(0, uint(img.Bounds().Dy()/2), img, resize.Lanczos3)
+	if opts.Format != "" {
+		format, err = imaging.NormalizeFormat(opts.Format)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	width, height := opts.Width, opts.Height
+	if width == 0 && height == 0 {
+		height = uint(img.Bounds().Dy() / 2)
+	}
+	fit := opts.Fit
+	if fit == "" {
+		fit = imaging.FitContain
+	}
+
+	newImg := imaging.Resize(img, width, height, fit)
 
 	outFile, err := os.Create(outputPath)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	defer outFile.Close()
 
-	switch strings.ToLower(format) {
-	case "jpeg", "jpg":
-		err = jpeg.Encode(outFile, newImg, &jpeg.Options{Quality: 70})
-	case "png":
-		err = png.Encode(outFile, newImg)
-	default:
-		return 0, fmt.Errorf("unsupported image format: %s", format)
-	}
-
+	err = imaging.Encode(outFile, newImg, format, opts.Quality)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
 	stat, err := outFile.Stat()
 	if err != nil {
-		return 0, err
+		return nil, 0, err
+	}
+
+	return newImg, stat.Size(), nil
+}
+
+// outputName returns the compressed file name for a revision of the job's
+// original. The first revision keeps the name outputs always had; later ones
+// get a revision suffix, and the extension of the format they are encoded in.
+func outputName(filename string, revision int, opts imaging.Options) string {
+	if revision <= 1 {
+		return "compressed_" + filename
 	}
 
-	return stat.Size(), nil
+	ext := filepath.Ext(filename)
+	if format, err := imaging.NormalizeFormat(opts.Format); err == nil {
+		ext = imaging.Extension(format)
+	}
+	return "compressed_" + strings.TrimSuffix(filename, filepath.Ext(filename)) + "-r" + strconv.Itoa(revision) + ext
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// alreadyProcessed reports whether attempt of the message with messageID was
+// handled before, meaning this delivery is a redelivery of it
+func alreadyProcessed(db *sql.DB, messageID string, attempt int) (bool, error) {
+	query := `SELECT outcome FROM processed_messages WHERE message_id = $1 AND attempt = $2`
+
+	var outcome string
+	err := db.QueryRow(query, messageID, attempt).Scan(&outcome)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordProcessed remembers that workerID handled attempt of the message with
+// messageID. A delivery that is not recorded is only deduplicated by the
+// job's status, so errors are only logged.
+func recordProcessed(db *sql.DB, messageID string, attempt, jobID int, outcome, workerID string) {
+	query := `
+        INSERT INTO processed_messages (message_id, attempt, job_id, outcome, worker_id)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (message_id, attempt) DO NOTHING
+    `
+	if _, err := db.Exec(query, messageID, attempt, jobID, outcome, workerID); err != nil {
+		log.Printf("Failed to record message %s attempt %d as processed: %v", messageID, attempt, err)
+	}
+}
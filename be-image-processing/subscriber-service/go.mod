@@ -3,7 +3,12 @@ module subscriber-service
 go 1.24
 
 require (
+	github.com/chai2010/webp v1.4.0
 	github.com/lib/pq v1.10.9
-	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
 	github.com/rabbitmq/amqp091-go v1.10.0
 )
+
+require shared v0.0.0
+
+replace shared => ../shared
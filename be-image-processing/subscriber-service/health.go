@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// healthState tracks the dependencies the worker needs, so an orchestrator can
+// see a RabbitMQ outage instead of a process that is alive but idle
+type healthState struct {
+	db       *sql.DB
+	rabbitmq atomic.Bool
+}
+
+type healthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	RabbitMQ string `json:"rabbitmq"`
+}
+
+func (h *healthState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "up", Database: "up", RabbitMQ: "up"}
+	status := http.StatusOK
+
+	if err := h.db.PingContext(r.Context()); err != nil {
+		resp.Database = "down"
+		status = http.StatusServiceUnavailable
+	}
+
+	if !h.rabbitmq.Load() {
+		resp.RabbitMQ = "down"
+		status = http.StatusServiceUnavailable
+	}
+
+	if status != http.StatusOK {
+		resp.Status = "down"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func startHealthServer(addr string, health *healthState) {
+	mux := http.NewServeMux()
+	mux.Handle("/health", health)
+
+	go func() {
+		log.Printf("🩺 Health endpoint listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Health server stopped: %v", err)
+		}
+	}()
+}
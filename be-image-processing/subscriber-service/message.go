@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/jobmessage"
+)
+
+// decodeJobMessage reads the job message of a delivery in any schema version
+// this build supports. A message in a newer schema is classified retryable so
+// it can be replayed from the dead letter queue once the subscriber is
+// upgraded; any other undecodable message fails the same way every time.
+func decodeJobMessage(msg amqp.Delivery) (jobmessage.Message, error) {
+	message, err := jobmessage.Decode(msg.ContentType, msg.Body)
+	if errors.Is(err, jobmessage.ErrUnsupportedVersion) {
+		return jobmessage.Message{}, retryable("decode message", err)
+	}
+	if err != nil {
+		return jobmessage.Message{}, permanent("decode message", err)
+	}
+	return message, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/jobmessage"
+)
+
+// Every message a publisher has sent, in every schema version, must decode.
+// The fixtures are the ones the shared contract pins the publisher's output to.
+func TestDecodeJobMessagePublishedFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob("../shared/jobmessage/testdata/*.json")
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no job message fixtures found: %v", err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			body, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+
+			message, err := decodeJobMessage(amqp.Delivery{ContentType: jobmessage.ContentType, Body: body})
+			if err != nil {
+				t.Fatalf("decodeJobMessage: %v", err)
+			}
+			if message.ID != 42 {
+				t.Errorf("job ID = %d, want 42", message.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeJobMessageClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		retryable bool
+	}{
+		{"newer schema", fmt.Sprintf(`{"schema_version":%d,"id":42}`, jobmessage.SchemaVersion+1), true},
+		{"malformed", `{"id":`, false},
+		{"missing job ID", `{}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeJobMessage(amqp.Delivery{ContentType: jobmessage.ContentType, Body: []byte(tt.body)})
+			if err == nil {
+				t.Fatal("decodeJobMessage succeeded, want an error")
+			}
+			if isRetryable(err) != tt.retryable {
+				t.Errorf("retryable = %t, want %t: %v", isRetryable(err), tt.retryable, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// workerConfig controls how many deliveries are processed at once. Prefetch
+// bounds how many unacked deliveries RabbitMQ hands this consumer; it should
+// be at least the concurrency or workers sit idle waiting for messages.
+type workerConfig struct {
+	Concurrency int
+	Prefetch    int
+	RetryDelays []time.Duration
+	// LeaseDuration is how long a job stays leased to a worker without a
+	// heartbeat before the reaper may take it over
+	LeaseDuration time.Duration
+	// ConfirmTimeout bounds how long a retry or dead-letter publish waits for
+	// the broker's confirm before the delivery is requeued instead
+	ConfirmTimeout time.Duration
+}
+
+// loadWorkerConfig reads WORKER_CONCURRENCY and WORKER_PREFETCH. Concurrency
+// defaults to the number of CPUs since compression is CPU bound, and prefetch
+// defaults to the concurrency.
+func loadWorkerConfig() workerConfig {
+	conf := workerConfig{
+		Concurrency: getEnvInt("WORKER_CONCURRENCY", runtime.NumCPU()),
+	}
+	if conf.Concurrency < 1 {
+		log.Fatalf("WORKER_CONCURRENCY must be at least 1, got %d", conf.Concurrency)
+	}
+
+	conf.Prefetch = getEnvInt("WORKER_PREFETCH", conf.Concurrency)
+	if conf.Prefetch < conf.Concurrency {
+		log.Fatalf("WORKER_PREFETCH (%d) must be at least WORKER_CONCURRENCY (%d)", conf.Prefetch, conf.Concurrency)
+	}
+
+	conf.RetryDelays = loadRetryDelays()
+
+	conf.LeaseDuration = getEnvDuration("LEASE_DURATION", time.Minute)
+	if conf.LeaseDuration < 3*time.Second {
+		log.Fatalf("LEASE_DURATION must be at least 3s, got %s", conf.LeaseDuration)
+	}
+
+	conf.ConfirmTimeout = getEnvDuration("RABBITMQ_CONFIRM_TIMEOUT", 5*time.Second)
+	if conf.ConfirmTimeout <= 0 {
+		log.Fatalf("RABBITMQ_CONFIRM_TIMEOUT must be positive, got %s", conf.ConfirmTimeout)
+	}
+
+	return conf
+}
+
+// runWorkers processes deliveries with conf.Concurrency goroutines and returns
+// once msgs is closed and every worker finished its current job. After
+// shutdown is cancelled, deliveries still buffered by the client are requeued
+// instead of started; cancelling jobCtx aborts the jobs in progress.
+func runWorkers(shutdown, jobCtx context.Context, db *sql.DB, conn *amqp.Connection, msgs <-chan amqp.Delivery, consumer string, conf workerConfig) {
+	var wg sync.WaitGroup
+	for i := 1; i <= conf.Concurrency; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			publisher := newConfirmedPublisher(conn, conf.ConfirmTimeout)
+			defer publisher.Close()
+
+			w := &worker{
+				name:          fmt.Sprintf("%s/worker-%d", consumer, id),
+				db:            db,
+				publisher:     publisher,
+				retryDelays:   conf.RetryDelays,
+				leaseDuration: conf.LeaseDuration,
+				logger:        log.New(os.Stderr, fmt.Sprintf("[worker-%d] ", id), log.LstdFlags|log.Lmsgprefix),
+			}
+			w.logger.Println("🚀 Started")
+			for d := range msgs {
+				if shutdown.Err() != nil {
+					d.Nack(false, true)
+					continue
+				}
+				w.processJob(jobCtx, d)
+			}
+			w.logger.Println("Stopped")
+		}(i)
+	}
+	wg.Wait()
+}
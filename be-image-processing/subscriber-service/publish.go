@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// errPublishNacked means the broker refused responsibility for the message
+	errPublishNacked = errors.New("broker nacked the message")
+	// errPublishReturned means the message matched no queue and came back as mandatory
+	errPublishReturned = errors.New("message was returned as unroutable")
+	// errPublishTimeout means no confirm arrived in time; the message may or may not be queued
+	errPublishTimeout = errors.New("timed out waiting for publisher confirm")
+)
+
+// confirmedPublisher publishes on a channel of its own in confirm mode and
+// waits for the broker to take responsibility for each message, so a delivery
+// is only acked once what replaces it is safely queued. The channel is opened
+// on first use and reopened after it failed or a confirm timed out, so a late
+// confirm or return can never be mistaken for a later publish.
+type confirmedPublisher struct {
+	conn    *amqp.Connection
+	timeout time.Duration
+
+	mu      sync.Mutex
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+func newConfirmedPublisher(conn *amqp.Connection, timeout time.Duration) *confirmedPublisher {
+	return &confirmedPublisher{conn: conn, timeout: timeout}
+}
+
+// publish sends msg as mandatory and returns once the broker confirmed it
+func (p *confirmedPublisher) publish(exchange, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch == nil || p.ch.IsClosed() {
+		if err := p.open(); err != nil {
+			return err
+		}
+	}
+
+	// Drop returns left over from earlier publishes on this channel
+	for len(p.returns) > 0 {
+		<-p.returns
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, msg)
+	if err != nil {
+		p.close()
+		return fmt.Errorf("publish to %s: %w", exchange, err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		p.close()
+		return fmt.Errorf("publish to %s: %w", exchange, errPublishTimeout)
+	}
+
+	// The broker sends basic.return before the confirm, so it is buffered by now
+	select {
+	case returned := <-p.returns:
+		return fmt.Errorf("publish to %s: %w: %d %s", exchange, errPublishReturned, returned.ReplyCode, returned.ReplyText)
+	default:
+	}
+
+	if !acked {
+		return fmt.Errorf("publish to %s: %w", exchange, errPublishNacked)
+	}
+	return nil
+}
+
+func (p *confirmedPublisher) open() error {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open publish channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("enable publisher confirms: %w", err)
+	}
+
+	p.ch = ch
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	return nil
+}
+
+func (p *confirmedPublisher) close() {
+	if p.ch != nil {
+		p.ch.Close()
+		p.ch = nil
+	}
+}
+
+// Close closes the channel when the worker stops
+func (p *confirmedPublisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.close()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/messaging"
+)
+
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+
+	// abortGrace is how long aborted jobs get to requeue themselves after the
+	// shutdown deadline before the connection is closed underneath them
+	abortGrace = 5 * time.Second
+)
+
+// errShutdown is returned by consume when it stopped because ctx was cancelled
+var errShutdown = errors.New("shutting down")
+
+// runConsumer keeps a consumer attached to the job queue, reconnecting with
+// exponential backoff whenever the connection or channel goes away, until ctx
+// is cancelled and the in-flight jobs are drained
+func runConsumer(ctx context.Context, db *sql.DB, rabbitURL string, workers workerConfig, shutdownTimeout time.Duration, health *healthState) {
+	backoff := minReconnectBackoff
+	for {
+		started := time.Now()
+		err := consume(ctx, db, rabbitURL, workers, shutdownTimeout, health)
+		health.rabbitmq.Store(false)
+
+		if errors.Is(err, errShutdown) {
+			return
+		}
+
+		// A consumer that ran for a while earned a fresh backoff
+		if time.Since(started) > maxReconnectBackoff {
+			backoff = minReconnectBackoff
+		}
+
+		log.Printf("⚠️ Consumer stopped: %v. Reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// consume connects, re-declares the topology and processes deliveries with a
+// pool of workers until the connection or channel closes, returning the
+// reason it stopped. When ctx is cancelled it cancels the consumer so no new
+// deliveries arrive, waits up to shutdownTimeout for the workers and then
+// aborts the remaining jobs, which requeue themselves.
+func consume(ctx context.Context, db *sql.DB, rabbitURL string, workers workerConfig, shutdownTimeout time.Duration, health *healthState) error {
+	conn, err := amqp.Dial(rabbitURL)
+	if err != nil {
+		return fmt.Errorf("connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	if err := messaging.DeclareTopology(conn); err != nil {
+		return fmt.Errorf("declare topology: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := messaging.DeclareRetryTiers(ch, workers.RetryDelays); err != nil {
+		return fmt.Errorf("declare retry tiers: %w", err)
+	}
+
+	// Messages left in the queue declared before priorities are consumed
+	// until it is deleted; see messaging.QueueLegacyImageJobs
+	legacy, legacyMessages, err := messaging.LegacyImageJobsExists(conn)
+	if err != nil {
+		return fmt.Errorf("check legacy queue: %w", err)
+	}
+
+	// Without a prefetch limit the broker pushes the whole queue to this
+	// consumer; with it, each worker has a delivery ready when it finishes.
+	// The limit applies per consumer, so while the legacy queue is drained
+	// by a second consumer it is applied to the whole channel instead, which
+	// the classic queues used here support.
+	if err := ch.Qos(workers.Prefetch, 0, legacy); err != nil {
+		return fmt.Errorf("set prefetch: %w", err)
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	tag := consumerTag()
+	msgs, err := ch.Consume(
+		messaging.QueueImageJobs, // queue
+		tag,                      // consumer tag
+		false,                    // auto-ack
+		false,                    // exclusive
+		false,                    // no-local
+		false,                    // no-wait
+		nil,                      // args
+	)
+	if err != nil {
+		return fmt.Errorf("register a consumer: %w", err)
+	}
+	tags := []string{tag}
+
+	if legacy {
+		legacyTag := tag + "-legacy"
+		legacyMsgs, err := ch.Consume(messaging.QueueLegacyImageJobs, legacyTag, false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("register a legacy consumer: %w", err)
+		}
+		log.Printf("📥 Draining %d messages left in legacy queue %s", legacyMessages, messaging.QueueLegacyImageJobs)
+		msgs = mergeDeliveries(msgs, legacyMsgs)
+		tags = append(tags, legacyTag)
+	}
+
+	health.rabbitmq.Store(true)
+	log.Printf("📥 Waiting for messages with %d workers, prefetch %d. To exit press CTRL+C", workers.Concurrency, workers.Prefetch)
+
+	jobCtx, abortJobs := context.WithCancel(context.Background())
+	defer abortJobs()
+
+	done := make(chan struct{})
+	go func() {
+		runWorkers(ctx, jobCtx, db, conn, msgs, tag, workers)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		drain(ch, tags, done, abortJobs, shutdownTimeout)
+		return errShutdown
+	}
+
+	// The delivery channel only closes when the channel or connection did
+	select {
+	case reason := <-connClosed:
+		return fmt.Errorf("connection closed: %v", reason)
+	case reason := <-channelClosed:
+		return fmt.Errorf("channel closed: %v", reason)
+	default:
+		return errors.New("delivery channel closed")
+	}
+}
+
+// drain stops new deliveries and waits for the workers. Deliveries that were
+// prefetched but not started are requeued by the workers.
+func drain(ch *amqp.Channel, tags []string, done <-chan struct{}, abortJobs context.CancelFunc, shutdownTimeout time.Duration) {
+	log.Printf("🛑 Shutdown requested, finishing in-flight jobs for up to %s", shutdownTimeout)
+
+	for _, tag := range tags {
+		if err := ch.Cancel(tag, false); err != nil {
+			log.Printf("Failed to cancel consumer %s: %v", tag, err)
+		}
+	}
+
+	select {
+	case <-done:
+		log.Println("✅ In-flight jobs finished")
+		return
+	case <-time.After(shutdownTimeout):
+	}
+
+	log.Printf("⏱️ Shutdown deadline reached, requeueing in-flight jobs")
+	abortJobs()
+
+	select {
+	case <-done:
+	case <-time.After(abortGrace):
+		log.Printf("Workers did not stop within %s, closing the connection", abortGrace)
+	}
+}
+
+// mergeDeliveries forwards the deliveries of both channels to one, which is
+// closed once both are
+func mergeDeliveries(a, b <-chan amqp.Delivery) <-chan amqp.Delivery {
+	merged := make(chan amqp.Delivery)
+
+	var wg sync.WaitGroup
+	for _, deliveries := range []<-chan amqp.Delivery{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				merged <- d
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// consumerTag identifies this process on the broker
+func consumerTag() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "subscriber"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"shared/messaging"
+)
+
+// jobError is a failed stage of processJob, classified by whether a later
+// attempt can succeed
+type jobError struct {
+	stage     string
+	err       error
+	retryable bool
+}
+
+func (e *jobError) Error() string {
+	return fmt.Sprintf("%s: %v", e.stage, e.err)
+}
+
+func (e *jobError) Unwrap() error {
+	return e.err
+}
+
+// retryable marks a failure that may go away on its own, such as a network
+// error or an unavailable dependency
+func retryable(stage string, err error) error {
+	return &jobError{stage: stage, err: err, retryable: true}
+}
+
+// permanent marks a failure that will repeat on every attempt, such as a
+// missing job or an image that cannot be decoded
+func permanent(stage string, err error) error {
+	return &jobError{stage: stage, err: err, retryable: false}
+}
+
+// failureStage returns the stage err was raised in
+func failureStage(err error) string {
+	var jobErr *jobError
+	if errors.As(err, &jobErr) {
+		return jobErr.stage
+	}
+	return "unknown"
+}
+
+// isRetryable reports whether err was classified as retryable
+func isRetryable(err error) bool {
+	var jobErr *jobError
+	return errors.As(err, &jobErr) && jobErr.retryable
+}
+
+// httpStatusError classifies an unexpected response: server errors, throttling
+// and timeouts are retryable, other client errors are not
+func httpStatusError(stage string, resp *http.Response) error {
+	err := fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+		return retryable(stage, err)
+	}
+	return permanent(stage, err)
+}
+
+// loadRetryDelays reads RETRY_DELAYS, a "|" separated list of durations
+func loadRetryDelays() []time.Duration {
+	delays, err := messaging.ParseRetryDelays(getEnv("RETRY_DELAYS", messaging.DefaultRetryDelays))
+	if err != nil {
+		log.Fatalf("Invalid RETRY_DELAYS: %v", err)
+	}
+	return delays
+}
+
+// attemptOf returns the attempt number a delivery is for. Messages retried
+// through the legacy retry_queue only carry the x-death count.
+func attemptOf(msg amqp.Delivery) int {
+	switch attempt := msg.Headers[messaging.HeaderAttempt].(type) {
+	case int32:
+		return int(attempt)
+	case int64:
+		return int(attempt)
+	}
+	return getRetryCount(msg.Headers) + 1
+}
+
+// scheduleRetry publishes the message to the retry tier for delay with the
+// next attempt number and returns once the broker confirmed it. The original
+// delivery must only be acked after it returned nil.
+func (w *worker) scheduleRetry(msg amqp.Delivery, nextAttempt int, delay time.Duration) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		if key == "x-death" {
+			continue
+		}
+		headers[key] = value
+	}
+	headers[messaging.HeaderAttempt] = int32(nextAttempt)
+
+	return w.publisher.publish(
+		messaging.ExchangeRetry,
+		messaging.RetryTierRoutingKey(delay),
+		amqp.Publishing{
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+			Priority:     msg.Priority,
+			ContentType:  msg.ContentType,
+			MessageId:    msg.MessageId,
+			Body:         msg.Body,
+		},
+	)
+}
+
+func getRetryCount(headers amqp.Table) int {
+	xDeathRaw, ok := headers["x-death"]
+	if !ok {
+		return 0
+	}
+
+	xDeathList, ok := xDeathRaw.([]interface{})
+	if !ok || len(xDeathList) == 0 {
+		return 0
+	}
+
+	xDeath, ok := xDeathList[0].(amqp.Table)
+	if !ok {
+		return 0
+	}
+
+	count, ok := xDeath["count"].(int64)
+	if !ok {
+		return 0
+	}
+
+	return int(count)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shared/jobstate"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// processRevision produces the pending revision of a completed job while
+// holding a lease on it. The job stays completed and keeps serving its
+// current output; the new output only replaces it once it is uploaded and
+// recorded. Retryable failures are scheduled on the retry tiers like a job's;
+// once they run out, or on a permanent failure, the revision is given up and
+// the job keeps its output. A cancel request, made when the job is deleted,
+// gives the revision up the same way. A revision is never dead-lettered,
+// since reprocessing the job again replaces it.
+func (w *worker) processRevision(ctx context.Context, msg amqp.Delivery, id, attempt int) {
+	revision, err := claimRevision(w.db, id, w.name, w.leaseDuration)
+	if err != nil {
+		switch revisionClaimAction(err) {
+		case actionSkip:
+			w.logger.Printf("Skipping job %d: %v", id, err)
+			msg.Ack(false)
+		case actionDefer:
+			w.deferDelivery(msg, id, attempt, err)
+		default:
+			w.logger.Printf("Failed to claim revision of job %d, requeueing: %v", id, err)
+			msg.Nack(false, true)
+		}
+		return
+	}
+	history := startAttempt(w.db, id, attempt, w.name)
+
+	leaseCtx, stopJob := context.WithCancelCause(ctx)
+	stopHeartbeat := w.heartbeat(leaseCtx, id, stopJob)
+	err = w.compressRevision(leaseCtx, id, revision)
+	stopHeartbeat()
+
+	if cause := context.Cause(leaseCtx); err != nil && ctx.Err() == nil &&
+		(errors.Is(cause, jobstate.ErrLeaseLost) || errors.Is(cause, jobstate.ErrCancelRequested)) {
+		err = fmt.Errorf("%w: %w", cause, err)
+	}
+
+	switch {
+	case err == nil:
+		w.logger.Printf("Successfully produced revision %d of job %d on attempt %d", revision, id, attempt)
+		history.finish(w.db, outcomeSucceeded, "completed", nil)
+		w.ack(msg, id, attempt, outcomeSucceeded)
+	case errors.Is(err, jobstate.ErrCancelRequested):
+		// Deleting the job requested it; the job keeps its current output
+		// until the delete is repeated
+		w.logger.Printf("Revision %d of job %d cancelled on attempt %d", revision, id, attempt)
+		if markErr := abandonRevision(w.db, id, w.name, "cancelled"); errors.Is(markErr, jobstate.ErrLeaseLost) {
+			history.finish(w.db, outcomeAborted, failureStage(err), err)
+			w.ack(msg, id, attempt, outcomeAborted)
+			return
+		}
+		history.finish(w.db, outcomeCancelled, failureStage(err), err)
+		w.ack(msg, id, attempt, outcomeCancelled)
+	case errors.Is(err, jobstate.ErrLeaseLost):
+		w.logger.Printf("Lost the lease on revision %d of job %d: %v", revision, id, err)
+		history.finish(w.db, outcomeAborted, failureStage(err), err)
+		w.ack(msg, id, attempt, outcomeAborted)
+	case ctx.Err() != nil:
+		w.logger.Printf("Revision %d of job %d aborted by shutdown, requeueing", revision, id)
+		history.finish(w.db, outcomeAborted, failureStage(err), err)
+		requeueRevision(w.db, id, w.name)
+		msg.Nack(false, true)
+	default:
+		outcome := w.handleRevisionFailure(msg, id, revision, attempt, err)
+		history.finish(w.db, outcome, failureStage(err), err)
+	}
+}
+
+// compressRevision produces the output of revision with its pending
+// processing options and makes it the job's current output
+func (w *worker) compressRevision(ctx context.Context, id, revision int) error {
+	query := `SELECT filename, pending_processing_options FROM image_jobs WHERE id = $1 AND pending_revision = $2`
+	var filename string
+	var rawOptions []byte
+	err := w.db.QueryRow(query, id, revision).Scan(&filename, &rawOptions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return permanent("fetch revision", err)
+	}
+	if err != nil {
+		return retryable("fetch revision", err)
+	}
+
+	opts, err := decodeProcessingOptions(rawOptions)
+	if err != nil {
+		return err
+	}
+
+	compressedFileName, compressedSize, err := w.produceOutput(ctx, id, filename, revision, opts)
+	if err != nil {
+		return err
+	}
+
+	err = completeRevision(w.db, id, w.name, revision, compressedFileName, compressedSize)
+	if errors.Is(err, jobstate.ErrLeaseLost) {
+		return err
+	}
+	if err != nil {
+		return retryable("record output", err)
+	}
+	return nil
+}
+
+// handleRevisionFailure schedules a retryable failure on the tier for this
+// attempt, or gives the revision up when it is permanent or the tiers are
+// exhausted. It returns the outcome of the attempt.
+func (w *worker) handleRevisionFailure(msg amqp.Delivery, id, revision, attempt int, err error) string {
+	if isRetryable(err) && attempt <= len(w.retryDelays) {
+		delay := w.retryDelays[attempt-1]
+
+		w.logger.Printf("Revision %d of job %d attempt %d failed, retrying in %s: %v", revision, id, attempt, delay, err)
+		if markErr := retryRevision(w.db, id, w.name, err.Error()); errors.Is(markErr, jobstate.ErrLeaseLost) {
+			w.ack(msg, id, attempt, outcomeAborted)
+			return outcomeAborted
+		}
+
+		if err := w.scheduleRetry(msg, attempt+1, delay); err != nil {
+			// The redelivery runs the same attempt again
+			w.logger.Printf("Failed to schedule retry for revision %d of job %d: %v", revision, id, err)
+			msg.Nack(false, true)
+			return outcomeAborted
+		}
+		w.ack(msg, id, attempt, outcomeRetrying)
+		return outcomeRetrying
+	}
+
+	if isRetryable(err) {
+		err = fmt.Errorf("max retries reached: %w", err)
+	}
+	w.logger.Printf("Giving up revision %d of job %d on attempt %d, the job keeps its output: %v", revision, id, attempt, err)
+
+	if markErr := abandonRevision(w.db, id, w.name, err.Error()); errors.Is(markErr, jobstate.ErrLeaseLost) {
+		w.ack(msg, id, attempt, outcomeAborted)
+		return outcomeAborted
+	}
+	w.ack(msg, id, attempt, outcomeFailed)
+	return outcomeFailed
+}
+
+// revisionClaimAction decides what happens to a delivery claimRevision
+// refused. A redelivery after the revision was produced is skipped. The
+// reaper only takes over processing jobs, so a revision leased by another
+// worker is deferred rather than skipped: the copy is dropped once the
+// revision is produced, or claims it after a dead worker's lease expires.
+func revisionClaimAction(err error) claimAction {
+	switch {
+	case errors.Is(err, errNoPendingRevision):
+		return actionSkip
+	case errors.Is(err, jobstate.ErrLeaseHeld):
+		return actionDefer
+	}
+	return actionRequeue
+}
+
+// deferDelivery publishes the message again for the same attempt after the
+// shortest retry delay and acks the original without recording it, so the
+// copy is not taken for a duplicate. The message is requeued if the copy
+// cannot be published, or right away when retries are disabled.
+func (w *worker) deferDelivery(msg amqp.Delivery, id, attempt int, err error) {
+	if len(w.retryDelays) == 0 {
+		w.logger.Printf("Requeueing job %d: %v", id, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	w.logger.Printf("Deferring job %d: %v", id, err)
+	if err := w.scheduleRetry(msg, attempt, w.retryDelays[0]); err != nil {
+		w.logger.Printf("Failed to defer job %d, requeueing: %v", id, err)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+}
+
+// isRevisionOf reports whether err from markProcessing means the job is
+// completed, so the message asks for its pending revision, if any
+func isRevisionOf(err error) bool {
+	var illegal *jobstate.IllegalTransitionError
+	return errors.As(err, &illegal) && illegal.From == jobstate.Completed
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"shared/jobstate"
+)
+
+// markProcessing moves the job to processing for attempt and leases it to
+// actor. It fails with jobstate.ErrIllegalTransition when the job is already
+// finished, and with jobstate.ErrLeaseHeld when another worker is processing
+// it under an unexpired lease.
+func markProcessing(db *sql.DB, id, attempt int, actor string, lease time.Duration) error {
+	fields := []jobstate.Field{
+		jobstate.Set("error_message", ""),
+		jobstate.Set("attempt", attempt),
+		jobstate.Set("next_retry_at", nil),
+	}
+
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:       jobstate.Processing,
+		Unleased: true,
+		Actor:    actor,
+		Reason:   fmt.Sprintf("attempt %d", attempt),
+		Fields:   append(fields, jobstate.Lease(actor, lease)...),
+	})
+	return err
+}
+
+// markCompleted records the uploaded output and completes the job. An output
+// purged by retention is replaced by this one.
+func markCompleted(db *sql.DB, id int, actor, compressedFileName string, compressedSize int64) error {
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:         jobstate.Completed,
+		LeaseOwner: actor,
+		Actor:      actor,
+		Fields: []jobstate.Field{
+			jobstate.Set("error_message", ""),
+			jobstate.Set("compressed_size", compressedSize),
+			jobstate.Set("compressed_file_name", compressedFileName),
+			jobstate.Set("compressed_purged_at", nil),
+			jobstate.SetExpr("completed_at", "NOW()"),
+		},
+	})
+	return err
+}
+
+// markRetrying records the failure of the current attempt and when the next
+// one is due
+func markRetrying(db *sql.DB, id int, actor, errorMsg string, nextRetryAt time.Time) error {
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:         jobstate.Retrying,
+		LeaseOwner: actor,
+		Actor:      actor,
+		Reason:     errorMsg,
+		Fields: []jobstate.Field{
+			jobstate.Set("error_message", errorMsg),
+			jobstate.Set("next_retry_at", nextRetryAt),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to mark job %d retrying: %v", id, err)
+	}
+	return err
+}
+
+// markFailed fails the job with reason
+func markFailed(db *sql.DB, id int, actor, reason string) error {
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:         jobstate.Failed,
+		LeaseOwner: actor,
+		Actor:      actor,
+		Reason:     reason,
+		Fields:     []jobstate.Field{jobstate.Set("error_message", reason)},
+	})
+	if err != nil {
+		log.Printf("Failed to mark job %d failed: %v", id, err)
+	}
+	return err
+}
+
+// markCancelled ends a job whose cancellation was requested while this
+// worker processed it
+func markCancelled(db *sql.DB, id int, actor string) error {
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:         jobstate.Cancelled,
+		LeaseOwner: actor,
+		Actor:      actor,
+		Reason:     "cancelled while processing",
+	})
+	if err != nil {
+		log.Printf("Failed to mark job %d cancelled: %v", id, err)
+	}
+	return err
+}
+
+// markRequeued puts a job this worker gave back to the queue to pending
+func markRequeued(db *sql.DB, id int, actor, reason string) {
+	_, err := jobstate.Transition(db, int64(id), jobstate.Change{
+		To:         jobstate.Pending,
+		LeaseOwner: actor,
+		Actor:      actor,
+		Reason:     reason,
+		Fields:     []jobstate.Field{jobstate.Set("error_message", "")},
+	})
+	if err != nil {
+		log.Printf("Failed to mark job %d pending: %v", id, err)
+	}
+}
+
+// errNoPendingRevision means the completed job has no revision to produce,
+// e.g. a redelivery after the revision completed
+var errNoPendingRevision = errors.New("job has no pending revision")
+
+// claimRevision leases the pending revision of a completed job to actor and
+// returns it. It fails with jobstate.ErrLeaseHeld while another worker holds
+// the lease, and with errNoPendingRevision when there is nothing to produce.
+func claimRevision(db *sql.DB, id int, actor string, lease time.Duration) (int, error) {
+	query := `
+		WITH locked AS (
+			SELECT id, pending_revision, COALESCE(lease_expires_at > NOW(), FALSE) AS lease_held
+			FROM image_jobs WHERE id = $1 AND status = $2 FOR UPDATE
+		), claimed AS (
+			UPDATE image_jobs j
+			SET lease_owner = $3, lease_expires_at = NOW() + $4 * INTERVAL '1 millisecond',
+			    cancel_requested_at = NULL, updated_at = NOW()
+			FROM locked
+			WHERE j.id = locked.id AND locked.pending_revision IS NOT NULL AND NOT locked.lease_held
+			RETURNING j.id
+		)
+		SELECT (SELECT pending_revision FROM locked), COALESCE((SELECT lease_held FROM locked), FALSE), EXISTS (SELECT 1 FROM claimed)
+	`
+
+	var revision sql.NullInt64
+	var leaseHeld, claimed bool
+	err := db.QueryRow(query, id, string(jobstate.Completed), actor, lease.Milliseconds()).Scan(&revision, &leaseHeld, &claimed)
+	if err != nil {
+		return 0, fmt.Errorf("claim revision of job %d: %w", id, err)
+	}
+	if !revision.Valid {
+		return 0, fmt.Errorf("claim revision of job %d: %w", id, errNoPendingRevision)
+	}
+	if !claimed && leaseHeld {
+		return 0, fmt.Errorf("claim revision %d of job %d: %w", revision.Int64, id, jobstate.ErrLeaseHeld)
+	}
+	return int(revision.Int64), nil
+}
+
+// completeRevision makes the uploaded output of revision the job's current
+// one and remembers the output it replaces for the sweep to remove. It fails
+// with jobstate.ErrLeaseLost unless actor still holds the revision's lease.
+func completeRevision(db *sql.DB, id int, actor string, revision int, compressedFileName string, compressedSize int64) error {
+	query := `
+		WITH completed AS (
+			UPDATE image_jobs
+			SET previous_compressed_file_name = compressed_file_name,
+			    compressed_file_name = $5, compressed_size = $6, compressed_purged_at = NULL,
+			    revision = pending_revision, processing_options = pending_processing_options,
+			    pending_revision = NULL, pending_processing_options = NULL, revision_error = NULL,
+			    lease_owner = NULL, lease_expires_at = NULL, completed_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND status = $2 AND lease_owner = $3 AND pending_revision = $4
+			RETURNING id
+		), audited AS (
+			INSERT INTO image_job_events (job_id, from_status, to_status, actor, reason)
+			SELECT id, $2, $2, $3, 'completed revision ' || $4 FROM completed
+		)
+		SELECT id FROM completed
+	`
+
+	var completed int
+	err := db.QueryRow(query, id, string(jobstate.Completed), actor, revision, compressedFileName, compressedSize).Scan(&completed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("complete revision %d of job %d: %w", revision, id, jobstate.ErrLeaseLost)
+	}
+	if err != nil {
+		return fmt.Errorf("complete revision %d of job %d: %w", revision, id, err)
+	}
+	return nil
+}
+
+// retryRevision records why the current attempt at the revision failed and
+// releases its lease until the next attempt
+func retryRevision(db *sql.DB, id int, actor, errorMsg string) error {
+	return releaseRevision(db, id, actor, false, errorMsg)
+}
+
+// abandonRevision gives up the pending revision of a completed job, which
+// keeps serving its current output, and records why
+func abandonRevision(db *sql.DB, id int, actor, reason string) error {
+	return releaseRevision(db, id, actor, true, reason)
+}
+
+// requeueRevision releases the lease on a revision this worker gave back to
+// the queue
+func requeueRevision(db *sql.DB, id int, actor string) {
+	if err := releaseRevision(db, id, actor, false, ""); err != nil {
+		log.Printf("Failed to release revision of job %d: %v", id, err)
+	}
+}
+
+// releaseRevision releases actor's lease on the revision of a completed job,
+// giving the revision up when abandon is set, and records errorMsg unless it
+// is empty. A cancel request is only meant for the lease holder, so it is
+// cleared too. It fails with jobstate.ErrLeaseLost when actor no longer holds
+// the lease.
+func releaseRevision(db *sql.DB, id int, actor string, abandon bool, errorMsg string) error {
+	query := `
+		UPDATE image_jobs
+		SET pending_revision = CASE WHEN $4 THEN NULL ELSE pending_revision END,
+		    pending_processing_options = CASE WHEN $4 THEN NULL ELSE pending_processing_options END,
+		    revision_error = COALESCE(NULLIF($5, ''), revision_error),
+		    lease_owner = NULL, lease_expires_at = NULL, cancel_requested_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $2 AND lease_owner = $3
+		RETURNING id
+	`
+
+	var released int
+	err := db.QueryRow(query, id, string(jobstate.Completed), actor, abandon, errorMsg).Scan(&released)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("release revision of job %d: %w", id, jobstate.ErrLeaseLost)
+	}
+	if err != nil {
+		return fmt.Errorf("release revision of job %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"shared/imaging"
+)
+
+// variantExtension is the format generated next to every output for clients
+// that accept it. The publisher serves the variant by this name when the
+// request's Accept header asks for WebP.
+const variantExtension = ".webp"
+
+// variantName returns the name of the WebP variant of a compressed output
+func variantName(compressedFileName string) string {
+	return strings.TrimSuffix(compressedFileName, filepath.Ext(compressedFileName)) + variantExtension
+}
+
+// writeVariant encodes img as WebP at quality to path and returns its size
+func writeVariant(path string, img image.Image, quality int) (int64, error) {
+	if quality <= 0 {
+		quality = imaging.DefaultQuality
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := webp.Encode(file, img, &webp.Options{Quality: float32(quality)}); err != nil {
+		return 0, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
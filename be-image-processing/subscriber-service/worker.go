@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"io"
@@ -11,134 +13,472 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
+	"shared/imaging"
+	"shared/jobstate"
+	"shared/messaging"
+	"time"
 )
 
-func processJob(db *sql.DB, msg amqp.Delivery) {
-	var jobMsg JobMessage
-	if err := json.Unmarshal(msg.Body, &jobMsg); err != nil {
-		log.Printf("Error unmarshalling message: %v", err)
-		msg.Nack(false, false)
+// worker processes deliveries for one goroutine of the pool
+type worker struct {
+	name          string
+	db            *sql.DB
+	publisher     *confirmedPublisher
+	retryDelays   []time.Duration
+	leaseDuration time.Duration
+	logger        *log.Logger
+}
+
+// processJob compresses the image of one job while holding a lease on it.
+// Cancelling ctx aborts the download and upload; an aborted job is put back to
+// pending and requeued. Retryable failures are scheduled on the next retry
+// tier until the tiers run out, permanent ones fail the job right away. When
+// the lease is lost the reaper has taken the job over, so the delivery is
+// acked without touching the job. A cancel request noticed by the heartbeat
+// aborts the job the same way, removes its partial outputs and cancels it.
+// Redeliveries of a message that was already handled, and duplicates of a job
+// another worker holds the lease on, are acked without work; see
+// isDuplicate and jobClaimAction. A message for a
+// completed job produces its pending revision instead.
+func (w *worker) processJob(ctx context.Context, msg amqp.Delivery) {
+	jobMsg, err := decodeJobMessage(msg)
+	if err != nil {
+		w.logger.Printf("Error decoding message %s: %v", msg.MessageId, err)
+		if err := w.deadLetter(msg, attemptOf(msg), err); err != nil {
+			w.logger.Printf("Failed to dead-letter message %s, requeueing: %v", msg.MessageId, err)
+			msg.Nack(false, true)
+			return
+		}
+		msg.Ack(false)
 		return
 	}
+	id := int(jobMsg.ID)
 
-	// Cek retry count
-	retryCount := getRetryCount(msg.Headers)
-	if retryCount >= 3 {
-		log.Printf("Job ID %d reached max retries. Sending to DLQ.", jobMsg.ID)
-		updateJobStatus(db, jobMsg.ID, "failed", "max retry reached", nil, nil)
-		msg.Ack(false) // go to DLQ
+	attempt := attemptOf(msg)
+	if msg.MessageId != "" {
+		processed, err := alreadyProcessed(w.db, msg.MessageId, attempt)
+		if err != nil {
+			w.logger.Printf("Failed to check message %s for duplicates, relying on the job's lease: %v", msg.MessageId, err)
+		}
+		if isDuplicate(processed, err) {
+			w.logger.Printf("Skipping redelivered message %s attempt %d for job %d", msg.MessageId, attempt, id)
+			msg.Ack(false)
+			return
+		}
+	}
+
+	if err := markProcessing(w.db, id, attempt, w.name, w.leaseDuration); err != nil {
+		switch jobClaimAction(err) {
+		case actionSkip:
+			w.logger.Printf("Skipping job %d: %v", id, err)
+			msg.Ack(false)
+		case actionRevision:
+			w.processRevision(ctx, msg, id, attempt)
+		default:
+			w.logger.Printf("Failed to mark job %d processing, requeueing: %v", id, err)
+			msg.Nack(false, true)
+		}
 		return
 	}
+	history := startAttempt(w.db, id, attempt, w.name)
+
+	leaseCtx, stopJob := context.WithCancelCause(ctx)
+	stopHeartbeat := w.heartbeat(leaseCtx, id, stopJob)
+	err = w.compressJob(leaseCtx, id)
+	stopHeartbeat()
+
+	if cause := context.Cause(leaseCtx); err != nil && ctx.Err() == nil &&
+		(errors.Is(cause, jobstate.ErrLeaseLost) || errors.Is(cause, jobstate.ErrCancelRequested)) {
+		err = fmt.Errorf("%w: %w", cause, err)
+	}
+
+	switch {
+	case err == nil:
+		w.logger.Printf("Successfully processed job %d on attempt %d", id, attempt)
+		history.finish(w.db, outcomeSucceeded, "completed", nil)
+		w.ack(msg, id, attempt, outcomeSucceeded)
+	case errors.Is(err, jobstate.ErrCancelRequested):
+		w.logger.Printf("Job %d cancelled on attempt %d", id, attempt)
+		if markErr := markCancelled(w.db, id, w.name); markErr != nil && !errors.Is(markErr, jobstate.ErrLeaseLost) {
+			// Leave the job to the reaper, which cancels it once the lease expires
+			history.finish(w.db, outcomeAborted, failureStage(err), err)
+			w.ack(msg, id, attempt, outcomeAborted)
+			return
+		}
+		history.finish(w.db, outcomeCancelled, failureStage(err), err)
+		w.ack(msg, id, attempt, outcomeCancelled)
+	case errors.Is(err, jobstate.ErrLeaseLost):
+		w.logger.Printf("Lost the lease on job %d, leaving it to the reaper: %v", id, err)
+		history.finish(w.db, outcomeAborted, failureStage(err), err)
+		w.ack(msg, id, attempt, outcomeAborted)
+	case ctx.Err() != nil:
+		history.finish(w.db, outcomeAborted, failureStage(err), err)
+		w.requeueAborted(id, msg)
+	default:
+		outcome := w.handleFailure(msg, id, attempt, err)
+		history.finish(w.db, outcome, failureStage(err), err)
+	}
+}
+
+// isDuplicate reports whether a delivery should be skipped, given what
+// alreadyProcessed returned for it. When the check fails the delivery is not
+// skipped: the lease markProcessing takes is the fallback that keeps a
+// duplicate from running alongside the original, and the job's status stops
+// one that arrives after the job finished.
+func isDuplicate(processed bool, err error) bool {
+	return err == nil && processed
+}
+
+// claimAction is what a worker does with a delivery whose job or revision it
+// could not claim
+type claimAction int
+
+const (
+	actionRequeue  claimAction = iota // nack, so the broker redelivers it now
+	actionSkip                        // ack without work
+	actionRevision                    // produce the job's pending revision instead
+	actionDefer                       // publish it again after the shortest retry delay
+)
+
+// jobClaimAction decides what happens to a delivery markProcessing refused.
+// A job leased by another worker is skipped: if that worker dies, the reaper
+// requeues the job once the lease expires, which is why the publisher does
+// not start without the reaper. A job that may not move to processing has
+// nothing left to do, e.g. on a redelivery after it completed, unless it is
+// a completed job with a revision to produce.
+func jobClaimAction(err error) claimAction {
+	switch {
+	case errors.Is(err, jobstate.ErrLeaseHeld):
+		return actionSkip
+	case isRevisionOf(err):
+		return actionRevision
+	case errors.Is(err, jobstate.ErrIllegalTransition), errors.Is(err, jobstate.ErrJobNotFound):
+		return actionSkip
+	}
+	return actionRequeue
+}
+
+// cancelPollInterval bounds how long a cancel request waits for the worker
+// to notice it
+const cancelPollInterval = 2 * time.Second
+
+// heartbeat extends the job's lease until the returned stop function is
+// called, beating every third of the lease duration or every
+// cancelPollInterval, whichever is shorter. If the lease is lost or the job's
+// cancellation is requested, stopJob cancels the job with
+// jobstate.ErrLeaseLost or jobstate.ErrCancelRequested as the cause.
+func (w *worker) heartbeat(ctx context.Context, id int, stopJob context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(min(w.leaseDuration/3, cancelPollInterval))
+		defer ticker.Stop()
 
-	updateJobStatus(db, jobMsg.ID, "processing", "", nil, nil)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 
-	query := `SELECT filename FROM image_jobs WHERE id = $1`
+			err := jobstate.Heartbeat(w.db, int64(id), w.name, w.leaseDuration)
+			if errors.Is(err, jobstate.ErrLeaseLost) {
+				stopJob(jobstate.ErrLeaseLost)
+				return
+			}
+			if errors.Is(err, jobstate.ErrCancelRequested) {
+				stopJob(jobstate.ErrCancelRequested)
+				return
+			}
+			if err != nil {
+				// The lease survives a missed beat; the next one may succeed
+				w.logger.Printf("Heartbeat for job %d failed: %v", id, err)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// compressJob produces the output of the job's current revision with its
+// processing options and marks the job completed
+func (w *worker) compressJob(ctx context.Context, id int) error {
+	query := `SELECT filename, revision, processing_options FROM image_jobs WHERE id = $1`
 	var filename string
-	err := db.QueryRow(query, jobMsg.ID).Scan(&filename)
+	var revision int
+	var rawOptions []byte
+	err := w.db.QueryRow(query, id).Scan(&filename, &revision, &rawOptions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return permanent("fetch job", err)
+	}
 	if err != nil {
-		log.Printf("Error fetching job data: %v", err)
-		updateJobStatus(db, jobMsg.ID, "failed", fmt.Sprintf("DB error: %v", err), nil, nil)
-		msg.Nack(false, false)
-		return
+		return retryable("fetch job", err)
+	}
+
+	opts, err := decodeProcessingOptions(rawOptions)
+	if err != nil {
+		return err
+	}
+
+	compressedFileName, compressedSize, err := w.produceOutput(ctx, id, filename, revision, opts)
+	if err != nil {
+		return err
 	}
 
+	err = markCompleted(w.db, id, w.name, compressedFileName, compressedSize)
+	if errors.Is(err, jobstate.ErrLeaseLost) {
+		return err
+	}
+	if errors.Is(err, jobstate.ErrIllegalTransition) {
+		return permanent("record output", err)
+	}
+	if err != nil {
+		return retryable("record output", err)
+	}
+	return nil
+}
+
+// decodeProcessingOptions reads the options stored for a revision; none
+// stored means the worker's defaults
+func decodeProcessingOptions(rawOptions []byte) (imaging.Options, error) {
+	var opts imaging.Options
+	if len(rawOptions) > 0 {
+		if err := json.Unmarshal(rawOptions, &opts); err != nil {
+			return opts, permanent("decode processing options", err)
+		}
+	}
+	return opts, nil
+}
+
+// produceOutput downloads the original, compresses it into revision with
+// opts and uploads the output with its WebP variant, returning the output's
+// name and size. The output is compressed into a temp file that is removed once the attempt ends, so an
+// aborted or failed attempt leaves no partial files behind; the outputs of
+// other revisions are left alone.
+func (w *worker) produceOutput(ctx context.Context, id int, filename string, revision int, opts imaging.Options) (string, int64, error) {
 	// Download image from provider service
 	imageURL := "http://publisher-service:8080/images-uploaded/" + filename
-	resp, err := http.Get(imageURL)
-	if err != nil || resp.StatusCode != 200 {
-		log.Printf("Error downloading image: %v", err)
-		updateJobStatus(db, jobMsg.ID, "failed", "failed to fetch image from provider", nil, nil)
-		msg.Nack(false, false)
-		return
+	resp, err := httpGet(ctx, imageURL)
+	if err != nil {
+		return "", 0, retryable("download original", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, httpStatusError("download original", resp)
+	}
 
-	tempInput := filepath.Join(os.TempDir(), filename)
-	out, err := os.Create(tempInput)
+	// Every attempt works on its own temp files, so a duplicate delivery of
+	// the job processed at the same time cannot write over them
+	out, err := os.CreateTemp("", "*-"+filename)
 	if err != nil {
-		log.Printf("Error creating temp file: %v", err)
-		msg.Nack(false, false)
-		return
+		return "", 0, retryable("create temp file", err)
 	}
-	io.Copy(out, resp.Body)
+	tempInput := out.Name()
+	_, err = io.Copy(out, resp.Body)
 	out.Close()
+	defer os.Remove(tempInput)
+	if err != nil {
+		return "", 0, retryable("download original", err)
+	}
 
-	outputPath := filepath.Join("./compressed", "compressed_"+filename)
+	compressedFileName := outputName(filename, revision, opts)
+	tempOutput, err := os.CreateTemp("", "*-"+compressedFileName)
+	if err != nil {
+		return "", 0, retryable("create temp file", err)
+	}
+	outputPath := tempOutput.Name()
+	tempOutput.Close()
+	defer os.Remove(outputPath)
 
-	compressedSize, err := compressImage(tempInput, outputPath)
+	img, compressedSize, err := compressImage(tempInput, outputPath, opts)
 	if err != nil {
-		log.Printf("Error compressing image: %v", err)
-		updateJobStatus(db, jobMsg.ID, "failed", fmt.Sprintf("Compression error: %v", err), nil, nil)
-		msg.Nack(false, false)
-		return
+		return "", 0, permanent("compress", err)
 	}
 
-	fileData, err := os.Open(outputPath)
+	// The variant is an optional extra, so a failure to encode it only loses
+	// it. One that is not smaller than the output is not worth serving.
+	variant := variantName(compressedFileName)
+	variantPath := ""
+	tempVariant, err := os.CreateTemp("", "*-"+variant)
 	if err != nil {
-		log.Printf("Failed to open compressed file: %v", err)
-		msg.Nack(false, false)
-		return
+		return "", 0, retryable("create temp file", err)
+	}
+	tempVariant.Close()
+	defer os.Remove(tempVariant.Name())
+	if variantSize, err := writeVariant(tempVariant.Name(), img, opts.Quality); err != nil {
+		w.logger.Printf("Skipping %s variant of job %d: %v", variantExtension, id, err)
+	} else if variantSize < compressedSize {
+		variantPath = tempVariant.Name()
+	}
+
+	// Compression can take a while; don't upload an output nobody wants
+	if err := jobstate.Heartbeat(w.db, int64(id), w.name, w.leaseDuration); errors.Is(err, jobstate.ErrCancelRequested) || errors.Is(err, jobstate.ErrLeaseLost) {
+		return "", 0, err
+	}
+
+	// The variant goes first, so it is in place once the output is recorded
+	if variantPath != "" {
+		if err := uploadOutput(ctx, variant, variantPath); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := uploadOutput(ctx, compressedFileName, outputPath); err != nil {
+		return "", 0, err
+	}
+
+	return compressedFileName, compressedSize, nil
+}
+
+// uploadOutput sends the file at path to the publisher's compressed storage
+// under name
+func uploadOutput(ctx context.Context, name, path string) error {
+	fileData, err := os.Open(path)
+	if err != nil {
+		return retryable("open compressed file", err)
 	}
 	defer fileData.Close()
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filepath.Base(outputPath))
+	part, err := writer.CreateFormFile("file", name)
 	if err != nil {
-		log.Printf("Error creating multipart: %v", err)
-		msg.Nack(false, false)
-		return
+		return retryable("create multipart", err)
 	}
 	io.Copy(part, fileData)
 	writer.Close()
 
-	uploadResp, err := http.Post("http://publisher-service:8080/compressed", writer.FormDataContentType(), body)
-	if err != nil || uploadResp.StatusCode != 200 {
-		log.Printf("Error uploading compressed image: %v", err)
-		msg.Nack(false, false)
-		return
+	uploadResp, err := httpPost(ctx, "http://publisher-service:8080/compressed", writer.FormDataContentType(), body)
+	if err != nil {
+		return retryable("upload output", err)
+	}
+	defer uploadResp.Body.Close()
+	if uploadResp.StatusCode != http.StatusOK {
+		return httpStatusError("upload output", uploadResp)
 	}
+	return nil
+}
 
-	compressedFileName := "compressed_" + filename
-	updateJobStatus(db, jobMsg.ID, "completed", "", &compressedSize, &compressedFileName)
+// handleFailure schedules a retryable failure on the tier for this attempt,
+// or fails the job and dead-letters the message when it is permanent or the
+// tiers are exhausted. It returns the outcome of the attempt.
+func (w *worker) handleFailure(msg amqp.Delivery, id, attempt int, err error) string {
+	if isRetryable(err) && attempt <= len(w.retryDelays) {
+		delay := w.retryDelays[attempt-1]
+		nextRetryAt := time.Now().Add(delay)
 
-	log.Printf("Successfully processed job %d", jobMsg.ID)
-	msg.Ack(false)
-}
+		w.logger.Printf("Job %d attempt %d failed, retrying in %s: %v", id, attempt, delay, err)
+		if markErr := markRetrying(w.db, id, w.name, err.Error(), nextRetryAt); errors.Is(markErr, jobstate.ErrLeaseLost) {
+			// The reaper already scheduled the next attempt
+			w.ack(msg, id, attempt, outcomeAborted)
+			return outcomeAborted
+		}
 
-func updateJobStatus(db *sql.DB, id int, status, errorMsg string, compressedSize *int64, compressedURL *string) {
-	query := `
-        UPDATE image_jobs 
-        SET status = $1, error_message = $2, compressed_size = $3, compressed_file_name = $4, updated_at = NOW() 
-        WHERE id = $5
-    `
-	_, err := db.Exec(query, status, errorMsg, compressedSize, compressedURL, id)
-	if err != nil {
-		log.Printf("Failed to update job status: %v", err)
+		if err := w.scheduleRetry(msg, attempt+1, delay); err != nil {
+			// The retry is not confirmed as queued; let the broker redeliver
+			// this attempt rather than risk losing the job. The redelivery
+			// runs the same attempt again, so this run is recorded as aborted.
+			w.logger.Printf("Failed to schedule retry for job %d: %v", id, err)
+			msg.Nack(false, true)
+			return outcomeAborted
+		}
+		w.ack(msg, id, attempt, outcomeRetrying)
+		return outcomeRetrying
+	}
+
+	if isRetryable(err) {
+		w.logger.Printf("Job %d failed after %d attempts: %v", id, attempt, err)
+		err = fmt.Errorf("max retries reached: %w", err)
+	} else {
+		w.logger.Printf("Job %d failed permanently on attempt %d: %v", id, attempt, err)
+	}
+
+	// Dead-letter before failing the job, so a job is never failed without
+	// its message in the DLQ to replay it from
+	if publishErr := w.deadLetter(msg, attempt, err); publishErr != nil {
+		w.logger.Printf("Failed to dead-letter message %s for job %d, requeueing: %v", msg.MessageId, id, publishErr)
+		markRequeued(w.db, id, w.name, "dead-letter publish failed")
+		msg.Nack(false, true)
+		return outcomeAborted
 	}
-}
 
-func getRetryCount(headers amqp.Table) int {
-	xDeathRaw, ok := headers["x-death"]
-	if !ok {
-		return 0
+	if markErr := markFailed(w.db, id, w.name, err.Error()); errors.Is(markErr, jobstate.ErrLeaseLost) {
+		// The reaper took the job over; replaying the dead letter is caught
+		// as a duplicate by the job's status
+		w.ack(msg, id, attempt, outcomeAborted)
+		return outcomeAborted
 	}
+	w.ack(msg, id, attempt, outcomeFailed)
+	return outcomeFailed
+}
 
-	xDeathList, ok := xDeathRaw.([]interface{})
-	if !ok || len(xDeathList) == 0 {
-		return 0
+// ack acks the delivery and records its message as processed with outcome,
+// so a redelivery of it is recognised as a duplicate
+func (w *worker) ack(msg amqp.Delivery, id, attempt int, outcome string) {
+	if msg.MessageId != "" {
+		recordProcessed(w.db, msg.MessageId, attempt, id, outcome, w.name)
 	}
+	msg.Ack(false)
+}
 
-	xDeath, ok := xDeathList[0].(amqp.Table)
-	if !ok {
-		return 0
+// deadLetter publishes the message to the failed_jobs queue with headers
+// describing the failure and returns once the broker confirmed it. The caller
+// acks the original only after it returned nil, and requeues it otherwise so
+// the message is not lost.
+func (w *worker) deadLetter(msg amqp.Delivery, attempt int, err error) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
 	}
+	headers[messaging.HeaderAttempt] = int32(attempt)
+	headers[messaging.HeaderFailureReason] = err.Error()
+	headers[messaging.HeaderFailureStage] = failureStage(err)
+	headers[messaging.HeaderRetryable] = isRetryable(err)
+	headers[messaging.HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	headers[messaging.HeaderFailedBy] = w.name
 
-	count, ok := xDeath["count"].(int64)
-	if !ok {
-		return 0
+	return w.publisher.publish(
+		messaging.ExchangeDeadLetter,
+		messaging.RoutingKeyFailedJobs,
+		amqp.Publishing{
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  msg.ContentType,
+			MessageId:    msg.MessageId,
+			Timestamp:    time.Now(),
+			Body:         msg.Body,
+		},
+	)
+}
+
+// requeueAborted hands a job interrupted by shutdown back to the queue so
+// another worker picks it up instead of it staying in processing
+func (w *worker) requeueAborted(id int, msg amqp.Delivery) {
+	w.logger.Printf("Job %d aborted by shutdown, requeueing", id)
+	markRequeued(w.db, id, w.name, "aborted by shutdown")
+	msg.Nack(false, true)
+}
+
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
+	return http.DefaultClient.Do(req)
+}
 
-	return int(count)
+func httpPost(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return http.DefaultClient.Do(req)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"shared/jobstate"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		name      string
+		processed bool
+		err       error
+		want      bool
+	}{
+		{"first delivery", false, nil, false},
+		{"redelivery", true, nil, true},
+		// The lease stops the duplicate instead
+		{"check failed", false, errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicate(tt.processed, tt.err); got != tt.want {
+				t.Errorf("isDuplicate(%t, %v) = %t, want %t", tt.processed, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobClaimAction(t *testing.T) {
+	illegalFrom := func(from jobstate.Status) error {
+		return fmt.Errorf("mark job 42 processing: %w", &jobstate.IllegalTransitionError{ID: 42, From: from, To: jobstate.Processing})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want claimAction
+	}{
+		{"lease held by another worker", fmt.Errorf("mark job 42 processing: %w", jobstate.ErrLeaseHeld), actionSkip},
+		{"completed job", illegalFrom(jobstate.Completed), actionRevision},
+		{"cancelled job", illegalFrom(jobstate.Cancelled), actionSkip},
+		{"deleted job", jobstate.ErrJobNotFound, actionSkip},
+		{"database error", errors.New("connection refused"), actionRequeue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobClaimAction(tt.err); got != tt.want {
+				t.Errorf("jobClaimAction(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// The reaper never takes over a revision, so a revision whose lease is held
+// must not be acked away
+func TestRevisionClaimAction(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want claimAction
+	}{
+		{"revision already produced", fmt.Errorf("claim revision of job 42: %w", errNoPendingRevision), actionSkip},
+		{"lease held by another worker", fmt.Errorf("claim revision 2 of job 42: %w", jobstate.ErrLeaseHeld), actionDefer},
+		{"database error", errors.New("connection refused"), actionRequeue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revisionClaimAction(tt.err); got != tt.want {
+				t.Errorf("revisionClaimAction(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
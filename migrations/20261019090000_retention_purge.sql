@@ -0,0 +1,12 @@
+-- Track retention state for uploaded originals and compressed outputs
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS compressed_file_name VARCHAR(255);
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS original_purged_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS compressed_purged_at TIMESTAMP WITH TIME ZONE;
+
+-- Jobs completed before this migration have no completion timestamp yet
+UPDATE image_jobs SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL;
+
+-- Add index for the retention sweeper
+CREATE INDEX IF NOT EXISTS idx_image_jobs_completed_at ON image_jobs (completed_at);
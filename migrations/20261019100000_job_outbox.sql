@@ -0,0 +1,15 @@
+-- Outbox of job messages written in the same transaction as the job row and
+-- relayed to RabbitMQ by the publisher
+
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  job_id INTEGER NOT NULL REFERENCES image_jobs (id) ON DELETE CASCADE,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  available_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  sent_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Add partial index so the relay only scans unsent messages
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox (available_at) WHERE sent_at IS NULL;
@@ -0,0 +1,6 @@
+-- Outbox messages the relay gave up on; their job is marked failed with the reason
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_outbox_unsent;
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox (available_at) WHERE sent_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,5 @@
+-- Retry tiers: the attempt a job is on and, while it waits in a retry tier
+-- queue, when the next attempt is due
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS attempt INT NOT NULL DEFAULT 0;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS next_retry_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,17 @@
+-- One row per processing attempt, so the history of a job survives the
+-- error_message of its latest attempt being overwritten
+
+CREATE TABLE IF NOT EXISTS image_job_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  job_id INT NOT NULL REFERENCES image_jobs (id) ON DELETE CASCADE,
+  attempt INT NOT NULL,
+  worker_id VARCHAR(255) NOT NULL,
+  started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMP WITH TIME ZONE,
+  outcome VARCHAR(20),
+  stage VARCHAR(50),
+  error TEXT,
+  duration_ms BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_job_attempts_job_id ON image_job_attempts (job_id, started_at);
@@ -0,0 +1,14 @@
+-- Audit trail of job status transitions. from_status is NULL for the event
+-- that records the job being created.
+
+CREATE TABLE IF NOT EXISTS image_job_events (
+  id BIGSERIAL PRIMARY KEY,
+  job_id INT NOT NULL REFERENCES image_jobs (id) ON DELETE CASCADE,
+  from_status VARCHAR(20),
+  to_status VARCHAR(20) NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  reason TEXT,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_job_events_job_id ON image_job_events (job_id, created_at);
@@ -0,0 +1,11 @@
+-- Worker leases: a processing job belongs to lease_owner until
+-- lease_expires_at, which the worker keeps pushing out with heartbeats. The
+-- reaper requeues or fails jobs whose lease expired.
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS lease_owner VARCHAR(255);
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_image_jobs_lease_expires_at ON image_jobs (lease_expires_at) WHERE status = 'processing';
+
+-- The attempt number a requeued message is published for
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS job_attempt INT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Cancellation of a processing job is requested by setting this flag; the
+-- worker polls it with its heartbeat, aborts and moves the job to cancelled
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,6 @@
+-- Jobs created by one POST /upload share a batch id so they can be selected
+-- together, e.g. by bulk retry
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS batch_id VARCHAR(32);
+
+CREATE INDEX IF NOT EXISTS idx_image_jobs_batch_id ON image_jobs (batch_id);
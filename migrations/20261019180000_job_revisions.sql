@@ -0,0 +1,7 @@
+-- Reprocessing a completed job produces a new output revision with the
+-- stored options. The previous output is kept, and still served, until the
+-- new revision completes; the retention sweep then removes it.
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS revision INT NOT NULL DEFAULT 1;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS processing_options JSONB;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS previous_compressed_file_name VARCHAR(255);
@@ -0,0 +1,6 @@
+-- Priority of a job: low, normal or high. Messages are published to the
+-- image_jobs priority queue with the matching level.
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS priority VARCHAR(10) NOT NULL DEFAULT 'normal';
+
+CREATE INDEX IF NOT EXISTS idx_image_jobs_priority ON image_jobs (priority, created_at);
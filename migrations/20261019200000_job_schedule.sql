@@ -0,0 +1,6 @@
+-- Jobs uploaded with process_after wait in the scheduled status until the
+-- publisher's scheduler enqueues them
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS process_after TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_image_jobs_scheduled ON image_jobs (process_after) WHERE status = 'scheduled';
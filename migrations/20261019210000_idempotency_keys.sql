@@ -0,0 +1,16 @@
+-- Responses stored under the Idempotency-Key header of upload and retry
+-- requests, replayed when a client repeats the request. A key without a
+-- response is claimed by a request still in flight.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  idempotency_key VARCHAR(255) PRIMARY KEY,
+  request_hash CHAR(64) NOT NULL,
+  response_status INTEGER,
+  response_content_type VARCHAR(255),
+  response_body BYTEA,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Add index so the sweeper finds expired keys without a full scan
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,14 @@
+-- Deliveries the subscriber finished handling, by message ID and attempt, so
+-- a redelivery of the same message is acked without processing the job again
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+  message_id VARCHAR(255) NOT NULL,
+  attempt INT NOT NULL,
+  job_id INT NOT NULL REFERENCES image_jobs (id) ON DELETE CASCADE,
+  outcome VARCHAR(20) NOT NULL,
+  worker_id VARCHAR(255) NOT NULL,
+  processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (message_id, attempt)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_job_id ON processed_messages (job_id);
@@ -0,0 +1,7 @@
+-- Slot a bulk retry or reprocess gave its outbox message, so concurrent bulk
+-- requests share one rate instead of each spacing out its own messages
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS paced_at TIMESTAMP WITH TIME ZONE;
+
+-- Add partial index so the next slot is found without scanning the outbox
+CREATE INDEX IF NOT EXISTS idx_outbox_paced_at ON outbox (paced_at) WHERE paced_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- A reprocess keeps the job completed, serving its current output, while the
+-- pending revision is produced. revision_error records why the last attempt
+-- at a revision failed, or why it was given up.
+
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS pending_revision INT;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS pending_processing_options JSONB;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS revision_error TEXT;
@@ -0,0 +1,4 @@
+-- Token of the request holding an idempotency key, so a request whose claim
+-- expired and was taken over cannot store or release the key of the new one
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS claim_token CHAR(32);